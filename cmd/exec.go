@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hashmap-kz/rconf/internal/cmd"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+	"github.com/spf13/cobra"
+)
+
+func newExecCmd() *cobra.Command {
+	var cfg cmd.Config
+
+	execCmd := &cobra.Command{
+		Use:   "exec [flags] -- COMMAND [ARGS...]",
+		Short: "Run an ad-hoc command on remote hosts via SSH (nothing is uploaded)",
+		Example: strings.TrimSpace(`
+rconf exec --inventory hosts.ini --limit web -- systemctl restart nginx
+rconf exec -H 'deploy@10.0.1.[11:40]?sudo=false' --stream -- 'df -h / | tail -1'
+`),
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			cfg.Command = commandLine(args)
+			return run(c, &cfg)
+		},
+	}
+
+	addConnFlags(execCmd, &cfg)
+	addRunFlags(execCmd, &cfg)
+	execCmd.MarkFlagsOneRequired("conn", "inventory")
+	return execCmd
+}
+
+// safeWord matches an argument that the shell reads as-is
+var safeWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// commandLine returns the shell command of the exec arguments: a single argument is a shell snippet
+// ('df -h / | tail -1') and is run as-is, several arguments are a command with its arguments and each one
+// is quoted when needed, so that 'grep "a b" /etc/hosts' stays three words.
+func commandLine(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	words := make([]string, 0, len(args))
+	for _, a := range args {
+		if safeWord.MatchString(a) {
+			words = append(words, a)
+		} else {
+			words = append(words, rconf.ShellQuote(a))
+		}
+	}
+	return strings.Join(words, " ")
+}
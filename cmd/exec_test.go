@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"systemctl", "restart", "nginx"}, "systemctl restart nginx"},
+		{[]string{"df -h / | tail -1"}, "df -h / | tail -1"},
+		{[]string{"grep", "a b", "/etc/hosts"}, "grep 'a b' /etc/hosts"},
+		{[]string{"echo", "it's", "$HOME", ""}, `echo 'it'\''s' '$HOME' ''`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, commandLine(tt.args))
+	}
+}
+
+func TestCommandLineWords(t *testing.T) {
+	// the remote shell splits the command line back into the arguments
+	args := []string{"a b", "it's", "$HOME", "*", ""}
+	out, err := exec.Command("sh", "-c", "printf '[%s]' "+commandLine(args)).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "[a b][it's][$HOME][*][]", string(out))
+}
+
+func TestExecQuotedArgs(t *testing.T) {
+	out, err := execute(t, "exec", "--conn", "deploy@10.0.1.15?sudo=false", "--dry-run", "--", "grep", "a b", "/etc/hosts")
+	require.NoError(t, err)
+	assert.Contains(t, out, "  1. grep 'a b' /etc/hosts\n")
+	assert.Contains(t, out, "; grep 'a b' /etc/hosts\n")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/cmd"
+	"github.com/hashmap-kz/rconf/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+func newPingCmd() *cobra.Command {
+	var cfg cmd.Config
+
+	pingCmd := &cobra.Command{
+		Use:   "ping",
+		Short: "Check that the hosts are reachable, accept the credentials, and provide SFTP and sudo",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			c.SilenceUsage = true
+			ctx, stop := signalContext()
+			defer stop()
+
+			_, err := runner.Ping(ctx, &cfg)
+			return err
+		},
+	}
+
+	addConnFlags(pingCmd, &cfg)
+	pingCmd.Flags().DurationVarP(&cfg.HostTimeout, "timeout", "", 10*time.Second, "Max time for the checks of a host (0: no limit, per host: ?host_timeout=)")
+	pingCmd.Flags().StringVarP(&cfg.Become, "become", "b", "", "Privilege escalation method of the scripts: the sudo check is required with sudo (default)")
+	pingCmd.Flags().BoolVarP(&cfg.AskBecomePass, "ask-become-pass", "K", false, "Ask for the sudo password (no echo), sudo is checked with it")
+	pingCmd.Flags().StringVarP(&cfg.BecomePassFile, "become-pass-file", "", "", "File with the sudo password (default from $RCONF_BECOME_PASS, per host: ?become_pass_file=)")
+	pingCmd.MarkFlagsMutuallyExclusive("ask-become-pass", "become-pass-file")
+	pingCmd.MarkFlagsOneRequired("conn", "inventory")
+	return pingCmd
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -8,43 +9,122 @@ import (
 	"github.com/hashmap-kz/rconf/internal/version"
 
 	"github.com/hashmap-kz/rconf/internal/cmd"
+	"github.com/hashmap-kz/rconf/internal/report"
 	"github.com/hashmap-kz/rconf/internal/runner"
 	"github.com/spf13/cobra"
 )
 
 func Execute() error {
+	return newRootCmd().Execute()
+}
+
+// newRootCmd returns the rconf command with its subcommands
+func newRootCmd() *cobra.Command {
 	var cfg cmd.Config
 
 	rootCmd := &cobra.Command{
 		Use:     "rconf",
 		Short:   "Execute local scripts on remote hosts via SSH",
 		Version: version.Version,
-		RunE: func(_ *cobra.Command, _ []string) error {
-			return runner.Run(&cfg)
+		RunE: func(c *cobra.Command, _ []string) error {
+			return run(c, &cfg)
 		},
 	}
 
-	rootCmd.Flags().StringVarP(&cfg.PrivateKeyPath, "pkey", "i", "", "Path to SSH private key (required when pkey-auth is used)")
-	rootCmd.Flags().StringVarP(&cfg.PrivateKeyPassphrase, "pkey-pass", "", "", "Passphrase to SSH private key (required when pkey is password-protected)")
+	addConnFlags(rootCmd, &cfg)
 	rootCmd.Flags().StringSliceVarP(&cfg.Filenames, "filename", "f", nil, "List of script paths or directories (required)")
-	rootCmd.Flags().StringSliceVarP(&cfg.ConnStrings, "conn", "H", nil, strings.TrimSpace(`
-List of remote hosts (required)
-Format: username:password@host:port?key1=value1&key2=value2
-- password is optional
-- port is optional (default 22)
-- query-opts are optional (available: sudo)
-`))
-	rootCmd.Flags().IntVarP(&cfg.WorkerLimit, "workers", "w", 2, "Max concurrent SSH connections")
-	rootCmd.Flags().StringVarP(&cfg.LogFile, "log", "l", "rconf.log", "Log file path")
+	addRunFlags(rootCmd, &cfg)
+	rootCmd.Flags().StringVarP(&cfg.RemoteDir, "remote-dir", "", "/tmp", "Base of the per-run remote directory, the scripts are uploaded to <remote-dir>/rconf-<run ID>")
+	rootCmd.Flags().BoolVarP(&cfg.KeepRemote, "keep-remote", "", false, "Keep the remote directory of the run after the scripts (for debugging)")
+	rootCmd.Flags().StringSliceVarP(&cfg.Tags, "tags", "", nil, "Run only the scripts tagged with one of these tags (# rconf: tags=...)")
+	rootCmd.Flags().StringSliceVarP(&cfg.SkipTags, "skip-tags", "", nil, "Do not run the scripts tagged with one of these tags")
+	rootCmd.Flags().BoolVarP(&cfg.Template, "template", "", false, "Render all scripts as Go templates (by default only *.tmpl files)")
+	rootCmd.Flags().StringArrayVarP(&cfg.Vars, "var", "", nil, "Template variable key=value (repeatable, wins over --vars-file and host variables)")
+	rootCmd.Flags().StringSliceVarP(&cfg.VarsFiles, "vars-file", "", nil, "YAML file with template variables (repeatable, later files win)")
 	rootCmd.Flags().BoolVarP(&cfg.Recursive, "recursive", "R", true, "Process the directory used in -f, --filename recursively")
+	rootCmd.Flags().StringSliceVarP(&cfg.Extensions, "ext", "", []string{".sh"}, "Extensions of the scripts taken from directories (e.g. .sh,.py)")
+	rootCmd.Flags().StringSliceVarP(&cfg.Interpreters, "interpreter", "", nil, "Interpreter of the scripts with an extension and no shebang: .py=/usr/bin/python3 (repeatable)")
 
-	requiredFlags := []string{"filename", "conn"}
+	requiredFlags := []string{"filename"}
 	for _, flag := range requiredFlags {
 		if err := rootCmd.MarkFlagRequired(flag); err != nil {
 			fmt.Printf("Failed to mark '%s' flag as required: %v", flag, err)
 			os.Exit(1)
 		}
 	}
+	rootCmd.MarkFlagsOneRequired("conn", "inventory")
+	rootCmd.AddCommand(newPingCmd(), newExecCmd())
+	return rootCmd
+}
+
+// run executes the scripts (or the ad-hoc command) and writes the reports
+func run(c *cobra.Command, cfg *cmd.Config) error {
+	reports, err := report.ParseSpecs(cfg.Reports)
+	if err != nil {
+		return err
+	}
+
+	// flags are valid at this point, failures are reported by the summary and the exit code
+	c.SilenceUsage = true
+	ctx, stop := signalContext()
+	defer stop()
+
+	result, err := runner.Run(ctx, cfg)
+	if result != nil {
+		if reportErr := report.WriteAll(reports, result); reportErr != nil {
+			return errors.Join(err, reportErr)
+		}
+	}
+	return err
+}
 
-	return rootCmd.Execute()
+// addRunFlags adds the flags that control a run and its reports, shared by the commands that execute
+func addRunFlags(c *cobra.Command, cfg *cmd.Config) {
+	c.Flags().DurationVarP(&cfg.ScriptTimeout, "script-timeout", "", 0, "Max execution time of a script, e.g. 10m (0: no limit, per host: ?script_timeout=)")
+	c.Flags().DurationVarP(&cfg.HostTimeout, "host-timeout", "", 0, "Max time for a host: connection and all scripts (0: no limit, per host: ?host_timeout=)")
+	c.Flags().DurationVarP(&cfg.Deadline, "deadline", "", 0, "Max time for the whole run (0: no limit)")
+	c.Flags().BoolVarP(&cfg.ContinueOnError, "continue-on-error", "", false, "Run the remaining scripts of a host after a failed script (default: the host stops)")
+	c.Flags().StringArrayVarP(&cfg.OnError, "on-error", "", nil, "Failure policy of the scripts matching a path or base name pattern: PATTERN=stop|continue (repeatable)")
+	c.Flags().BoolVarP(&cfg.FailFast, "fail-fast", "", false, "Stop starting new hosts after the first failed host (running hosts finish)")
+	c.Flags().StringVarP(&cfg.MaxFail, "max-fail", "", "", "Stop starting new hosts when more hosts failed than N, or P% of the hosts")
+	c.Flags().StringVarP(&cfg.Serial, "serial", "", "", "Run the hosts in batches of N or P% hosts, e.g. 1,5,25% (last size repeats, a batch starts when the previous ones succeeded)")
+	c.Flags().DurationVarP(&cfg.Pause, "pause", "", 0, "Wait between batches of --serial, e.g. 30s")
+	c.Flags().BoolVarP(&cfg.Confirm, "confirm", "", false, "Ask for confirmation before every batch of --serial after the first")
+	c.Flags().BoolVarP(&cfg.Stream, "stream", "", false, "Print the remote stdout/stderr line by line as it arrives, prefixed with the host")
+	c.Flags().BoolVarP(&cfg.DryRun, "dry-run", "", false, "Print the scripts, remote paths, commands and content hashes of every host, without uploading or executing")
+	c.Flags().BoolVarP(&cfg.DryRunConnect, "dry-run-connect", "", false, "Like --dry-run, and check the connection and authentication of every host")
+	c.Flags().StringSliceVarP(&cfg.Reports, "report", "", nil, "Write execution reports: json=PATH, junit=PATH")
+	c.Flags().StringVarP(&cfg.Become, "become", "b", "", "Privilege escalation method: sudo (default), doas, su, pbrun, none (per host: ?become=, per script: # rconf: become=)")
+	c.Flags().StringVarP(&cfg.BecomeUser, "become-user", "", "", "Run the scripts as this user instead of root, e.g. postgres (per host: ?become_user=)")
+	c.Flags().BoolVarP(&cfg.AskBecomePass, "ask-become-pass", "K", false, "Ask for the sudo password (no echo), fed to 'sudo -S' on every host")
+	c.Flags().StringVarP(&cfg.BecomePassFile, "become-pass-file", "", "", "File with the sudo password (default from $RCONF_BECOME_PASS, per host: ?become_pass_file=)")
+	c.MarkFlagsMutuallyExclusive("ask-become-pass", "become-pass-file")
+	c.Flags().StringArrayVarP(&cfg.Env, "env", "e", nil, "Environment variable of the scripts KEY=VAL (repeatable, wins over --env-file, per host: ?env.KEY=)")
+	c.Flags().StringArrayVarP(&cfg.EnvFiles, "env-file", "", nil, "File with environment variables of the scripts, KEY=VAL lines (repeatable, later files win)")
+	c.Flags().StringArrayVarP(&cfg.Args, "args", "", nil, "Positional parameter of the scripts, $1, $2... (repeatable, per host: ?args=)")
+}
+
+// addConnFlags adds the flags that select and connect to the hosts, shared by the commands
+func addConnFlags(c *cobra.Command, cfg *cmd.Config) {
+	c.Flags().StringVarP(&cfg.PrivateKeyPath, "pkey", "i", "", "Path to SSH private key (required when pkey-auth is used)")
+	c.Flags().StringVarP(&cfg.PrivateKeyPassphrase, "pkey-pass", "", "", "Passphrase to SSH private key (required when pkey is password-protected)")
+	// a value is never split on commas: they separate the hops of the jump query-opt
+	c.Flags().StringArrayVarP(&cfg.ConnStrings, "conn", "H", nil, strings.TrimSpace(`
+Remote host, repeatable (required unless --inventory is used)
+Format: username:password@host:port?key1=value1&key2=value2
+- username is optional (default from ssh config, or the local user)
+- password is optional
+- port is optional (default from ssh config, or 22)
+- host may be an alias from ssh config
+- query-opts are optional (available: sudo, become, become_user, become_pass, become_pass_file, hostkey, agent, key, jump, interpreter, script_timeout, host_timeout, env.NAME, args)
+`))
+	c.Flags().StringVarP(&cfg.Inventory, "inventory", "", "", "Inventory file with hosts, groups and variables (YAML, or Ansible-style INI)")
+	c.Flags().StringVarP(&cfg.Limit, "limit", "", "", "Select inventory hosts or groups: web,db1, wildcards (web*), exclusions (!web07)")
+	c.Flags().StringVarP(&cfg.SSHConfigPath, "ssh-config", "F", "", "Path to ssh client config (default ~/.ssh/config and /etc/ssh/ssh_config, 'none' to disable)")
+	c.Flags().BoolVarP(&cfg.UseAgent, "use-agent", "", false, "Authenticate with keys from ssh-agent (SSH_AUTH_SOCK)")
+	c.Flags().StringVarP(&cfg.Jump, "jump", "J", "", "Jump hosts for all connections: user@bastion:port[,user@inner:port] (per host: ?jump=)")
+	c.Flags().StringVarP(&cfg.KnownHostsPath, "known-hosts", "", "", "Path to known_hosts file (default ~/.ssh/known_hosts)")
+	c.Flags().StringVarP(&cfg.HostKeyCheck, "host-key-check", "", "strict", "Host key verification mode: strict, accept-new, off")
+	c.Flags().IntVarP(&cfg.WorkerLimit, "workers", "w", 2, "Max concurrent SSH connections")
+	c.Flags().StringVarP(&cfg.LogFile, "log", "l", "rconf.log", "Log file path")
 }
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// execute runs the rconf command with the args and returns what it printed to stdout
+func execute(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	prev := os.Stdout
+	os.Stdout = w
+	t.Cleanup(func() { os.Stdout = prev })
+
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(&out, r)
+		close(done)
+	}()
+
+	c := newRootCmd()
+	// the common flags go before '-- COMMAND' of rconf exec
+	common := []string{"--ssh-config", "none", "--log", filepath.Join(t.TempDir(), "rconf.log")}
+	if i := slices.Index(args, "--"); i >= 0 {
+		args = slices.Concat(args[:i], common, args[i:])
+	} else {
+		args = append(args, common...)
+	}
+	c.SetArgs(args)
+	c.SetOut(io.Discard)
+	c.SetErr(io.Discard)
+	err = c.Execute()
+
+	os.Stdout = prev
+	w.Close()
+	<-done
+	return out.String(), err
+}
+
+func writeScript(t *testing.T) string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "00-hello.sh")
+	require.NoError(t, os.WriteFile(script, []byte("echo hello\n"), 0o600))
+	return script
+}
+
+func TestConnJumpHosts(t *testing.T) {
+	// the example of the README: the comma separates the hops, not the hosts
+	out, err := execute(t, "-f", writeScript(t), "--dry-run",
+		"--conn", "deploy@10.0.1.15?jump=admin@bastion:22,admin@inner")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, strings.Count(out, "📋 Plan for"), out)
+	assert.Contains(t, out, "📋 Plan for deploy@10.0.1.15:22")
+	assert.Contains(t, out, "  via: admin@bastion:22 -> admin@inner:22\n")
+	assert.NotContains(t, out, "inner:22 (connection not checked)")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hashmap-kz/rconf/internal/runner"
+)
+
+// signalContext returns a context canceled by the first SIGINT or SIGTERM,
+// so that the run stops the remote scripts and still prints the summary.
+// A second signal exits immediately.
+func signalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig, ok := <-sigs
+		if !ok {
+			return
+		}
+		fmt.Printf("\n🛑 Received %s, stopping remote scripts (repeat to exit immediately)...\n", sig)
+		cancel(fmt.Errorf("canceled by %s signal", sig))
+
+		if _, ok := <-sigs; ok {
+			fmt.Println("\n🛑 Exiting immediately")
+			os.Exit(runner.ExitInterrupted)
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(sigs)
+		cancel(nil)
+	}
+}
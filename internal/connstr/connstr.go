@@ -13,10 +13,35 @@ type ConnInfo struct {
 	Host     string
 	Port     string
 	Opts     map[string][]string
+	Jumps    []*ConnInfo // jump hosts, in connection order
+
+	// IdentityFiles come from the ssh config, they are tried after the explicit keys
+	// and skipped when they cannot be loaded
+	IdentityFiles []string
 }
 
+// DefaultPort is the default SSH port
+const DefaultPort = "22"
+
 // ParseConnectionString parses the connection string using the `net/url` package
 func ParseConnectionString(connStr string) (*ConnInfo, error) {
+	info, err := ParsePartialConnectionString(connStr)
+	if err != nil {
+		return nil, err
+	}
+	if info.Port == "" {
+		info.Port = DefaultPort
+	}
+	if err := info.Validate(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ParsePartialConnectionString parses the connection string without checking the required fields,
+// the user and the port are left empty when they're not set.
+// The result is completed from other sources (e.g. ssh_config) and then validated.
+func ParsePartialConnectionString(connStr string) (*ConnInfo, error) {
 	if strings.TrimSpace(connStr) == "" {
 		return nil, fmt.Errorf("empty connection string")
 	}
@@ -43,14 +68,7 @@ func ParseConnectionString(connStr string) (*ConnInfo, error) {
 	// Extract host and port
 	hostName := u.Hostname()
 	port := u.Port()
-	if port == "" {
-		port = "22" // Default SSH port
-	}
 
-	// Check required
-	if user == "" {
-		return nil, fmt.Errorf("user is required")
-	}
 	if hostName == "" {
 		return nil, fmt.Errorf("hostname is required")
 	}
@@ -63,3 +81,17 @@ func ParseConnectionString(connStr string) (*ConnInfo, error) {
 		Opts:     u.Query(),
 	}, nil
 }
+
+// Validate checks the required fields
+func (c *ConnInfo) Validate() error {
+	if c.User == "" {
+		return fmt.Errorf("user is required")
+	}
+	if c.Host == "" {
+		return fmt.Errorf("hostname is required")
+	}
+	if c.Port == "" {
+		return fmt.Errorf("port is required")
+	}
+	return nil
+}
@@ -88,3 +88,137 @@ func TestParseConnectionString(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePartialConnectionString(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *ConnInfo
+		wantErr bool
+	}{
+		{
+			name:  "Alias only",
+			input: "db-prod-1",
+			want:  &ConnInfo{Host: "db-prod-1", Opts: map[string][]string{}},
+		},
+		{
+			name:  "Alias with opts",
+			input: "db-prod-1?sudo=false",
+			want:  &ConnInfo{Host: "db-prod-1", Opts: map[string][]string{"sudo": {"false"}}},
+		},
+		{
+			name:  "Full connection string",
+			input: "user:pass@host:2222",
+			want:  &ConnInfo{User: "user", Password: "pass", Host: "host", Port: "2222", Opts: map[string][]string{}},
+		},
+		{
+			name:    "Missing host",
+			input:   "user@:2222",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePartialConnectionString(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpandConnectionStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "No pattern",
+			input: []string{"deploy@web1:22?sudo=false", "db1"},
+			want:  []string{"deploy@web1:22?sudo=false", "db1"},
+		},
+		{
+			name:  "Zero-padded range",
+			input: []string{"deploy@web[08:11].dc1:22"},
+			want:  []string{"deploy@web08.dc1:22", "deploy@web09.dc1:22", "deploy@web10.dc1:22", "deploy@web11.dc1:22"},
+		},
+		{
+			name:  "Range in an address",
+			input: []string{"root:secret@10.0.1.[9:11]?sudo=false"},
+			want:  []string{"root:secret@10.0.1.9?sudo=false", "root:secret@10.0.1.10?sudo=false", "root:secret@10.0.1.11?sudo=false"},
+		},
+		{
+			name:  "Several ranges, letters and steps",
+			input: []string{"ssh://db[a:b]-[1:5:2]"},
+			want:  []string{"ssh://dba-1", "ssh://dba-3", "ssh://dba-5", "ssh://dbb-1", "ssh://dbb-3", "ssh://dbb-5"},
+		},
+		{
+			name:  "CIDR",
+			input: []string{"root@10.0.2.0/29?sudo=false"},
+			want: []string{
+				"root@10.0.2.1?sudo=false", "root@10.0.2.2?sudo=false", "root@10.0.2.3?sudo=false",
+				"root@10.0.2.4?sudo=false", "root@10.0.2.5?sudo=false", "root@10.0.2.6?sudo=false",
+			},
+		},
+		{
+			name:  "CIDR with port",
+			input: []string{"root@10.0.2.7/31:2222"},
+			want:  []string{"root@10.0.2.6:2222", "root@10.0.2.7:2222"},
+		},
+		{
+			name:  "IPv6 CIDR",
+			input: []string{"root@[2001:db8::/127]:22"},
+			want:  []string{"root@[2001:db8::]:22", "root@[2001:db8::1]:22"},
+		},
+		{
+			name:  "IPv6 address is not a range",
+			input: []string{"root@[::1]:22"},
+			want:  []string{"root@[::1]:22"},
+		},
+		{
+			name:  "Exclusions",
+			input: []string{"deploy@web[01:05]", "!web02", "!web0[4:5]", "root@10.0.1.[1:3]:2222", "!10.0.1.2:2222"},
+			want:  []string{"deploy@web01", "deploy@web03", "root@10.0.1.1:2222", "root@10.0.1.3:2222"},
+		},
+		{
+			name:  "Exclusion by short name",
+			input: []string{"deploy@web[06:08].dc1", "!web07", "!web08.dc1"},
+			want:  []string{"deploy@web06.dc1"},
+		},
+		{
+			name:    "Short name of an address",
+			input:   []string{"root@10.0.1.[1:2]", "!10"},
+			wantErr: true,
+		},
+		{name: "Exclusion with another port", input: []string{"root@10.0.1.3:2222", "!10.0.1.3:22"}, wantErr: true},
+		{name: "Exclusion matches no host", input: []string{"web[06:08].dc1", "!web09"}, wantErr: true},
+		{
+			name:  "Wildcard exclusion",
+			input: []string{"root@10.0.2.0/29", "!10.0.2.[1:4]", "!*.6"},
+			want:  []string{"root@10.0.2.5"},
+		},
+		{name: "Reversed range", input: []string{"web[10:01]"}, wantErr: true},
+		{name: "Mixed range", input: []string{"web[1:c]"}, wantErr: true},
+		{name: "Too many hosts", input: []string{"web[0:999]-[0:999]"}, wantErr: true},
+		{name: "CIDR too large", input: []string{"10.0.0.0/8"}, wantErr: true},
+		{name: "Invalid CIDR", input: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandConnectionStrings(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
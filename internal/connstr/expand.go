@@ -0,0 +1,271 @@
+package connstr
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxExpandedHosts limits the number of hosts a single pattern expands to
+const MaxExpandedHosts = 65536
+
+var (
+	// [01:40], [1:40:2], [a:f]
+	rangeRe = regexp.MustCompile(`\[(\d+|[a-zA-Z]):(\d+|[a-zA-Z])(?::(\d+))?\]`)
+	// 10.0.2.0/28, 10.0.2.0/28:2222, [2001:db8::/120]:2222
+	cidrRe = regexp.MustCompile(`^(?:(\d+\.\d+\.\d+\.\d+/\d+)|\[([0-9a-fA-F:.]+/\d+)\])(:\d+)?$`)
+)
+
+// ExpandConnectionStrings expands the host patterns of the connection strings, in order:
+//
+//   - ranges: 'deploy@web[01:40].dc1:22' (zero-padding is kept), 'root@10.0.1.[10:20]', 'web[a:c]', steps 'web[1:9:2]'
+//   - CIDR blocks: 'root@10.0.2.0/28?sudo=false' (without the network and broadcast addresses)
+//   - exclusions: '!web07', '!web[05:09]', '!10.0.2.*' remove the matching hosts (a port is matched when given);
+//     a name matches the host or its short name ('!web07' removes 'web07.dc1'), an exclusion that matches
+//     no host is an error
+//
+// The user, password, port and query-opts of a pattern are kept in every expanded connection string.
+func ExpandConnectionStrings(connStrs []string) ([]string, error) {
+	var result []string
+	var exclusions []*exclusion
+	for _, connStr := range connStrs {
+		connStr = strings.TrimSpace(connStr)
+		if strings.HasPrefix(connStr, "!") {
+			expanded, err := expandConnectionString(connStr[1:])
+			if err != nil {
+				return nil, err
+			}
+			exclusions = append(exclusions, &exclusion{pattern: connStr, hosts: expanded})
+			continue
+		}
+		expanded, err := expandConnectionString(connStr)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expanded...)
+	}
+	if len(exclusions) == 0 {
+		return result, nil
+	}
+
+	filtered := result[:0]
+	for _, connStr := range result {
+		excluded, err := isExcluded(connStr, exclusions)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			filtered = append(filtered, connStr)
+		}
+	}
+	for _, e := range exclusions {
+		if !e.matched {
+			return nil, fmt.Errorf("exclusion %q matches no host", e.pattern)
+		}
+	}
+	return filtered, nil
+}
+
+// exclusion is a '!' pattern, expanded into its hosts
+type exclusion struct {
+	pattern string
+	hosts   []string
+	matched bool
+}
+
+// isExcluded reports whether the host of the connection string matches one of the exclusions,
+// the matching exclusions are marked
+func isExcluded(connStr string, exclusions []*exclusion) (bool, error) {
+	info, err := ParsePartialConnectionString(connStr)
+	if err != nil {
+		return false, err
+	}
+	excluded := false
+	for _, e := range exclusions {
+		for _, h := range e.hosts {
+			excl, err := ParsePartialConnectionString(h)
+			if err != nil {
+				return false, fmt.Errorf("invalid exclusion: %w", err)
+			}
+			matched, err := matchHost(excl.Host, info.Host)
+			if err != nil {
+				return false, fmt.Errorf("invalid exclusion %q: %w", e.pattern, err)
+			}
+			if matched && (excl.Port == "" || excl.Port == info.Port) {
+				e.matched, excluded = true, true
+				break
+			}
+		}
+	}
+	return excluded, nil
+}
+
+// matchHost matches the pattern against the host, or against its short name (the part before the first dot)
+// unless the host is an IP address
+func matchHost(pattern, host string) (bool, error) {
+	matched, err := path.Match(pattern, host)
+	if err != nil || matched {
+		return matched, err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return false, nil
+	}
+	short, _, ok := strings.Cut(host, ".")
+	if !ok {
+		return false, nil
+	}
+	return path.Match(pattern, short)
+}
+
+// expandConnectionString expands the ranges or the CIDR block in the host of a connection string
+func expandConnectionString(connStr string) ([]string, error) {
+	prefix, hostPort, suffix := splitHostPort(connStr)
+
+	if m := cidrRe.FindStringSubmatch(hostPort); m != nil {
+		hosts, err := expandCIDR(m[1] + m[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", connStr, err)
+		}
+		result := make([]string, 0, len(hosts))
+		for _, h := range hosts {
+			if strings.Contains(h, ":") {
+				h = "[" + h + "]"
+			}
+			result = append(result, prefix+h+m[3]+suffix)
+		}
+		return result, nil
+	}
+
+	hostPorts, err := expandRanges(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", connStr, err)
+	}
+	result := make([]string, 0, len(hostPorts))
+	for _, hp := range hostPorts {
+		result = append(result, prefix+hp+suffix)
+	}
+	return result, nil
+}
+
+// expandRanges expands the first range of the string, and the ranges of the rest recursively
+func expandRanges(s string) ([]string, error) {
+	loc := rangeRe.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return []string{s}, nil
+	}
+	values, err := expandRange(s[loc[2]:loc[3]], s[loc[4]:loc[5]], submatch(s, loc, 3))
+	if err != nil {
+		return nil, err
+	}
+	tails, err := expandRanges(s[loc[1]:])
+	if err != nil {
+		return nil, err
+	}
+	if len(values)*len(tails) > MaxExpandedHosts {
+		return nil, fmt.Errorf("expands to more than %d hosts", MaxExpandedHosts)
+	}
+
+	result := make([]string, 0, len(values)*len(tails))
+	for _, v := range values {
+		for _, tail := range tails {
+			result = append(result, s[:loc[0]]+v+tail)
+		}
+	}
+	return result, nil
+}
+
+func submatch(s string, loc []int, n int) string {
+	if loc[2*n] < 0 {
+		return ""
+	}
+	return s[loc[2*n]:loc[2*n+1]]
+}
+
+// splitHostPort splits the connection string into 'scheme://user:pass@', 'host:port' and '?query'
+func splitHostPort(connStr string) (prefix, hostPort, suffix string) {
+	rest := connStr
+	if i := strings.Index(rest, "://"); i >= 0 {
+		prefix, rest = rest[:i+3], rest[i+3:]
+	}
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest, suffix = rest[:i], rest[i:]
+	}
+	if i := strings.LastIndexByte(rest, '@'); i >= 0 {
+		prefix, rest = prefix+rest[:i+1], rest[i+1:]
+	}
+	return prefix, rest, suffix
+}
+
+// expandRange returns the values of a numeric ('01', '40') or alphabetic ('a', 'f') range
+func expandRange(start, end, step string) ([]string, error) {
+	inc := 1
+	if step != "" {
+		n, err := strconv.Atoi(step)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid range step: %q", step)
+		}
+		inc = n
+	}
+
+	first, errFirst := strconv.Atoi(start)
+	last, errLast := strconv.Atoi(end)
+	switch {
+	case errFirst == nil && errLast == nil:
+		if first > last {
+			return nil, fmt.Errorf("invalid range: [%s:%s]", start, end)
+		}
+		if (last-first)/inc+1 > MaxExpandedHosts {
+			return nil, fmt.Errorf("range [%s:%s] expands to more than %d hosts", start, end, MaxExpandedHosts)
+		}
+		// a leading zero keeps the width: [01:40] -> 01, 02, ..., 40
+		width := 0
+		if len(start) > 1 && start[0] == '0' {
+			width = len(start)
+		}
+		values := make([]string, 0, (last-first)/inc+1)
+		for i := first; i <= last; i += inc {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+		return values, nil
+	case errFirst != nil && errLast != nil:
+		if start > end {
+			return nil, fmt.Errorf("invalid range: [%s:%s]", start, end)
+		}
+		var values []string
+		for c := int(start[0]); c <= int(end[0]); c += inc {
+			values = append(values, string(rune(c)))
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("invalid range: [%s:%s] (mixed numbers and letters)", start, end)
+}
+
+// expandCIDR returns the addresses of the block, without the network and broadcast addresses of IPv4 blocks
+// larger than /31
+func expandCIDR(cidr string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR block: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 16 {
+		return nil, fmt.Errorf("CIDR block %s expands to more than %d hosts", prefix, MaxExpandedHosts)
+	}
+
+	var hosts []string
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr.String())
+		if !addr.Next().IsValid() {
+			break
+		}
+	}
+	if prefix.Addr().Is4() && hostBits >= 2 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
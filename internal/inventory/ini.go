@@ -0,0 +1,148 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ParseINI parses an Ansible-style INI inventory:
+//
+//	db0 host=10.0.1.10
+//
+//	[web]
+//	web1 host=10.0.1.11
+//	web2 host=10.0.1.12 port=2222
+//
+//	[prod:children]
+//	web
+//
+//	[prod:vars]
+//	sudo=false
+//
+//	[all:vars]
+//	user=deploy
+//
+// Hosts before the first section are ungrouped.
+func ParseINI(data []byte) (*Inventory, error) {
+	inv := newInventory()
+
+	section, kind := "", "hosts"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid section: %s", lineNum, line)
+			}
+			section, kind = line[1:len(line)-1], "hosts"
+			if name, suffix, ok := strings.Cut(section, ":"); ok {
+				section, kind = name, suffix
+			}
+			switch kind {
+			case "hosts", "vars", "children":
+			default:
+				return nil, fmt.Errorf("line %d: invalid section type %q (expected vars or children)", lineNum, kind)
+			}
+			if section == "" {
+				return nil, fmt.Errorf("line %d: missing group name", lineNum)
+			}
+			inv.group(section)
+			continue
+		}
+
+		fields, err := splitFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch kind {
+		case "hosts":
+			vars, err := parseVars(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			inv.addHost(section, fields[0], vars)
+		case "vars":
+			vars, err := parseVars(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			g := inv.group(section)
+			for k, v := range vars {
+				g.Vars[k] = v
+			}
+		case "children":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("line %d: expected a group name: %s", lineNum, line)
+			}
+			inv.addChild(section, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inv, inv.finish()
+}
+
+// parseVars parses 'key=value' fields
+func parseVars(fields []string) (map[string][]string, error) {
+	vars := map[string][]string{}
+	for _, f := range fields {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid variable: %q (expected key=value)", f)
+		}
+		vars[k] = []string{v}
+	}
+	return vars, nil
+}
+
+// splitFields splits the line on whitespace, double or single quotes keep spaces in a value (key="a b").
+// A '#' starting a field begins a comment.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				field.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inField = r, true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		case r == '#' && !inField:
+			return fields, nil
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
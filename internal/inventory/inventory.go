@@ -0,0 +1,379 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+)
+
+// Implicit groups (same as Ansible)
+const (
+	GroupAll       = "all"
+	GroupUngrouped = "ungrouped"
+)
+
+// Host is an inventory host with its own variables.
+type Host struct {
+	Name   string
+	Vars   map[string][]string // resolved by Load: global, group (parents first) and host variables
+	Groups []string            // all groups of the host (parents first), without the implicit ones
+	groups []string            // direct groups, in file order
+	vars   map[string][]string // host variables, as written
+}
+
+// Group is a named set of hosts and child groups with shared variables.
+type Group struct {
+	Name     string
+	Vars     map[string][]string
+	Hosts    []string
+	Children []string
+}
+
+// Inventory holds the hosts (in file order) and the groups of an inventory file.
+type Inventory struct {
+	hosts  []*Host
+	byName map[string]*Host
+	groups map[string]*Group
+}
+
+func newInventory() *Inventory {
+	return &Inventory{byName: map[string]*Host{}, groups: map[string]*Group{}}
+}
+
+// Load reads an inventory file: YAML (.yml, .yaml) or Ansible-style INI (any other name).
+func Load(filename string) (*Inventory, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var inv *Inventory
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		inv, err = ParseYAML(data)
+	default:
+		inv, err = ParseINI(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return inv, nil
+}
+
+// Hosts returns all hosts in file order.
+func (inv *Inventory) Hosts() []*Host {
+	return inv.hosts
+}
+
+// Group returns the group by name.
+func (inv *Inventory) Group(name string) (*Group, bool) {
+	g, ok := inv.groups[name]
+	return g, ok
+}
+
+// group returns the group, created on first use
+func (inv *Inventory) group(name string) *Group {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &Group{Name: name, Vars: map[string][]string{}}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+// addHost adds the host to the group (created on first use), the host variables are merged
+func (inv *Inventory) addHost(groupName, hostName string, vars map[string][]string) {
+	h, ok := inv.byName[hostName]
+	if !ok {
+		h = &Host{Name: hostName, vars: map[string][]string{}}
+		inv.byName[hostName] = h
+		inv.hosts = append(inv.hosts, h)
+	}
+	for k, v := range vars {
+		h.vars[k] = v
+	}
+	if groupName == "" || slices.Contains(h.groups, groupName) {
+		return
+	}
+	h.groups = append(h.groups, groupName)
+	g := inv.group(groupName)
+	g.Hosts = append(g.Hosts, hostName)
+}
+
+func (inv *Inventory) addChild(parent, child string) {
+	inv.group(child)
+	g := inv.group(parent)
+	if !slices.Contains(g.Children, child) {
+		g.Children = append(g.Children, child)
+	}
+}
+
+// finish links the implicit groups and resolves the variables of every host
+func (inv *Inventory) finish() error {
+	all := inv.group(GroupAll)
+
+	parents := map[string][]string{}
+	for _, g := range inv.groups {
+		for _, c := range g.Children {
+			parents[c] = append(parents[c], g.Name)
+		}
+	}
+	for _, h := range inv.hosts {
+		if len(h.groups) == 0 || (len(h.groups) == 1 && h.groups[0] == GroupAll) {
+			h.groups = []string{GroupUngrouped}
+			inv.group(GroupUngrouped).Hosts = append(inv.group(GroupUngrouped).Hosts, h.Name)
+		}
+	}
+	names := make([]string, 0, len(inv.groups))
+	for name := range inv.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name != GroupAll && len(parents[name]) == 0 {
+			all.Children = append(all.Children, name)
+			parents[name] = []string{GroupAll}
+		}
+	}
+
+	depths := map[string]int{}
+	for _, name := range names {
+		if _, err := groupDepth(name, parents, depths, map[string]bool{}); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range inv.hosts {
+		ancestors := map[string]bool{}
+		for _, g := range h.groups {
+			collectAncestors(g, parents, ancestors)
+		}
+		groups := make([]string, 0, len(ancestors))
+		for g := range ancestors {
+			groups = append(groups, g)
+		}
+		// like Ansible: parents before children, then by name, the host variables win
+		sort.Slice(groups, func(i, j int) bool {
+			if depths[groups[i]] != depths[groups[j]] {
+				return depths[groups[i]] < depths[groups[j]]
+			}
+			return groups[i] < groups[j]
+		})
+
+		h.Vars = map[string][]string{}
+		h.Groups = nil
+		for _, g := range groups {
+			mergeVars(h.Vars, inv.groups[g].Vars)
+			if g != GroupAll && g != GroupUngrouped {
+				h.Groups = append(h.Groups, g)
+			}
+		}
+		mergeVars(h.Vars, h.vars)
+	}
+	return nil
+}
+
+// groupDepth returns the length of the longest path from 'all' to the group
+func groupDepth(name string, parents map[string][]string, depths map[string]int, visiting map[string]bool) (int, error) {
+	if name == GroupAll {
+		return 0, nil
+	}
+	if d, ok := depths[name]; ok {
+		return d, nil
+	}
+	if visiting[name] {
+		return 0, fmt.Errorf("group %q is its own child", name)
+	}
+	visiting[name] = true
+	depth := 0
+	for _, p := range parents[name] {
+		d, err := groupDepth(p, parents, depths, visiting)
+		if err != nil {
+			return 0, err
+		}
+		depth = max(depth, d+1)
+	}
+	depths[name] = depth
+	return depth, nil
+}
+
+func collectAncestors(name string, parents map[string][]string, seen map[string]bool) {
+	if seen[name] {
+		return
+	}
+	seen[name] = true
+	for _, p := range parents[name] {
+		collectAncestors(p, parents, seen)
+	}
+}
+
+// groupHosts returns the names of the hosts of the group and of its children
+func (inv *Inventory) groupHosts(name string, result map[string]bool) {
+	if name == GroupAll {
+		for _, h := range inv.hosts {
+			result[h.Name] = true
+		}
+		return
+	}
+	g := inv.groups[name]
+	for _, h := range g.Hosts {
+		result[h] = true
+	}
+	for _, c := range g.Children {
+		inv.groupHosts(c, result)
+	}
+}
+
+// Select returns the hosts matched by the limit, in file order (all hosts when the limit is empty).
+//
+// The limit is a comma-separated list of host names, group names or wildcard patterns
+// (e.g. 'web*,db1'); '!pattern' excludes hosts, '&pattern' keeps only the hosts also matched by the pattern.
+func (inv *Inventory) Select(limit string) ([]*Host, error) {
+	if strings.TrimSpace(limit) == "" {
+		return inv.hosts, nil
+	}
+
+	var include, exclude map[string]bool
+	var intersect []map[string]bool
+	for _, term := range strings.Split(limit, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		op := byte(0)
+		if term[0] == '!' || term[0] == '&' {
+			op, term = term[0], term[1:]
+		}
+		matched, err := inv.match(term)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case '!':
+			exclude = union(exclude, matched)
+		case '&':
+			intersect = append(intersect, matched)
+		default:
+			include = union(include, matched)
+		}
+	}
+
+	var result []*Host
+	for _, h := range inv.hosts {
+		if include != nil && !include[h.Name] || exclude[h.Name] {
+			continue
+		}
+		selected := true
+		for _, m := range intersect {
+			selected = selected && m[h.Name]
+		}
+		if selected {
+			result = append(result, h)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no hosts selected by limit %q", limit)
+	}
+	return result, nil
+}
+
+// match returns the names of the hosts matched by a group name, a host name or a wildcard pattern
+func (inv *Inventory) match(pattern string) (map[string]bool, error) {
+	result := map[string]bool{}
+	if _, ok := inv.groups[pattern]; ok {
+		inv.groupHosts(pattern, result)
+		return result, nil
+	}
+	if _, ok := inv.byName[pattern]; ok {
+		result[pattern] = true
+		return result, nil
+	}
+
+	for name := range inv.groups {
+		if ok, err := path.Match(pattern, name); err != nil {
+			return nil, fmt.Errorf("invalid limit pattern %q: %w", pattern, err)
+		} else if ok {
+			inv.groupHosts(name, result)
+		}
+	}
+	for _, h := range inv.hosts {
+		if ok, _ := path.Match(pattern, h.Name); ok {
+			result[h.Name] = true
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("limit pattern %q matches no hosts or groups", pattern)
+	}
+	return result, nil
+}
+
+// ConnInfo returns the connection details of the host from its variables:
+// 'host' (the address, default: the inventory name), 'user', 'port', 'password';
+// the other variables become query-opts (e.g. sudo, key, jump).
+//
+// Missing user and port are left empty, to be resolved like a partial connection string.
+func (h *Host) ConnInfo() *connstr.ConnInfo {
+	info := &connstr.ConnInfo{
+		Host:     h.lookup("host", h.Name),
+		User:     h.lookup("user", ""),
+		Port:     h.lookup("port", ""),
+		Password: h.lookup("password", ""),
+		Opts:     map[string][]string{},
+	}
+	for k, v := range h.Vars {
+		switch k {
+		case "host", "user", "port", "password":
+		default:
+			info.Opts[k] = v
+		}
+	}
+	return info
+}
+
+// lookup returns the last value of the variable
+func (h *Host) lookup(key, def string) string {
+	if v := h.Vars[key]; len(v) > 0 {
+		return v[len(v)-1]
+	}
+	return def
+}
+
+// mergeVars copies the variables, at the same level the rconf names win over the Ansible ones
+func mergeVars(dst, src map[string][]string) {
+	for k, v := range src {
+		if varName(k) != k {
+			dst[varName(k)] = v
+		}
+	}
+	for k, v := range src {
+		if varName(k) == k {
+			dst[k] = v
+		}
+	}
+}
+
+// varName maps the Ansible connection variables (ansible_host, ansible_user, ansible_port, ansible_password)
+// to their rconf names, so that existing inventories work as-is
+func varName(key string) string {
+	switch key {
+	case "ansible_host", "ansible_user", "ansible_port", "ansible_password":
+		return strings.TrimPrefix(key, "ansible_")
+	}
+	return key
+}
+
+func union(a, b map[string]bool) map[string]bool {
+	if a == nil {
+		a = map[string]bool{}
+	}
+	for k := range b {
+		a[k] = true
+	}
+	return a
+}
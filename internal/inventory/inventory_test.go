@@ -0,0 +1,200 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testYAML = `
+all:
+  vars:
+    user: deploy
+    sudo: true
+  hosts:
+    bastion:
+      host: 10.0.0.1
+  children:
+    web:
+      hosts:
+        web1:
+          host: 10.0.1.11
+        web2:
+          host: 10.0.1.12
+          port: 2222
+      vars:
+        jump: admin@bastion
+    db:
+      hosts:
+        db1:
+          ansible_host: 10.0.2.11
+          ansible_user: postgres
+          key:
+            - ~/.ssh/id_db
+            - ~/.ssh/id_ed25519
+    prod:
+      children:
+        web:
+        db:
+      vars:
+        sudo: false
+        jump: admin@prod-bastion
+`
+
+const testINI = `
+bastion host=10.0.0.1
+
+[web]
+web1 host=10.0.1.11
+web2 host=10.0.1.12 port=2222  # moved
+
+[web:vars]
+jump=admin@bastion
+
+[db]
+db1 ansible_host=10.0.2.11 ansible_user=postgres key=~/.ssh/id_db
+
+[prod:children]
+web
+db
+
+[prod:vars]
+sudo=false
+jump=admin@prod-bastion
+
+; global variables
+[all:vars]
+user=deploy
+sudo=true
+`
+
+func TestParse(t *testing.T) {
+	parsers := map[string]func() (*Inventory, error){
+		"YAML": func() (*Inventory, error) { return ParseYAML([]byte(testYAML)) },
+		"INI":  func() (*Inventory, error) { return ParseINI([]byte(testINI)) },
+	}
+
+	for name, parse := range parsers {
+		t.Run(name, func(t *testing.T) {
+			inv, err := parse()
+			require.NoError(t, err)
+
+			var names []string
+			for _, h := range inv.Hosts() {
+				names = append(names, h.Name)
+			}
+			assert.Equal(t, []string{"bastion", "web1", "web2", "db1"}, names)
+
+			hosts := map[string]*Host{}
+			for _, h := range inv.Hosts() {
+				hosts[h.Name] = h
+			}
+
+			// global variables
+			assert.Equal(t, &connstr.ConnInfo{
+				User: "deploy", Host: "10.0.0.1",
+				Opts: map[string][]string{"sudo": {"true"}},
+			}, hosts["bastion"].ConnInfo())
+
+			// child group variables win over the parent ones, host variables win over the group ones
+			assert.Equal(t, &connstr.ConnInfo{
+				User: "deploy", Host: "10.0.1.12", Port: "2222",
+				Opts: map[string][]string{"sudo": {"false"}, "jump": {"admin@bastion"}},
+			}, hosts["web2"].ConnInfo())
+
+			db1 := hosts["db1"].ConnInfo()
+			assert.Equal(t, "postgres", db1.User)
+			assert.Equal(t, "10.0.2.11", db1.Host)
+			assert.Equal(t, []string{"admin@prod-bastion"}, db1.Opts["jump"])
+			assert.Equal(t, "~/.ssh/id_db", db1.Opts["key"][0])
+
+			assert.Equal(t, []string{"prod", "db"}, hosts["db1"].Groups)
+			assert.Empty(t, hosts["bastion"].Groups)
+
+			prod, ok := inv.Group("prod")
+			require.True(t, ok)
+			assert.Equal(t, []string{"web", "db"}, prod.Children)
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	inv, err := ParseINI([]byte(testINI))
+	require.NoError(t, err)
+
+	tests := []struct {
+		limit   string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{"bastion", "web1", "web2", "db1"}, false},
+		{"all", []string{"bastion", "web1", "web2", "db1"}, false},
+		{"web", []string{"web1", "web2"}, false},
+		{"prod", []string{"web1", "web2", "db1"}, false},
+		{"ungrouped", []string{"bastion"}, false},
+		{"db1,web2", []string{"web2", "db1"}, false},
+		{"web*", []string{"web1", "web2"}, false},
+		{"prod,!web2", []string{"web1", "db1"}, false},
+		{"!prod", []string{"bastion"}, false},
+		{"prod,&web", []string{"web1", "web2"}, false},
+		{"nope", nil, true},
+		{"web,!web", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			hosts, err := inv.Select(tt.limit)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, h := range hosts {
+				names = append(names, h.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := ParseINI([]byte("[web:hosts\nweb1\n"))
+	assert.Error(t, err)
+
+	_, err = ParseINI([]byte("[web:unknown]\nweb1\n"))
+	assert.Error(t, err)
+
+	_, err = ParseINI([]byte("[web]\nweb1 port\n"))
+	assert.Error(t, err)
+
+	_, err = ParseINI([]byte("[a:children]\nb\n[b:children]\na\n"))
+	assert.Error(t, err)
+
+	_, err = ParseYAML([]byte("all:\n  hostz:\n    web1:\n"))
+	assert.Error(t, err)
+
+	_, err = ParseYAML([]byte("all:\n  hosts:\n    - web1\n"))
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "hosts.yml")
+	iniPath := filepath.Join(dir, "hosts")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(testYAML), 0o600))
+	require.NoError(t, os.WriteFile(iniPath, []byte(testINI), 0o600))
+
+	for _, path := range []string{yamlPath, iniPath} {
+		inv, err := Load(path)
+		require.NoError(t, err)
+		assert.Len(t, inv.Hosts(), 4)
+	}
+
+	_, err := Load(filepath.Join(dir, "missing.ini"))
+	assert.Error(t, err)
+}
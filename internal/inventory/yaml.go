@@ -0,0 +1,136 @@
+package inventory
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseYAML parses an Ansible-style YAML inventory:
+//
+//	all:
+//	  vars:
+//	    user: deploy
+//	  children:
+//	    web:
+//	      hosts:
+//	        web1:
+//	          host: 10.0.1.11
+//	        web2:
+//	    db:
+//	      hosts:
+//	        db1:
+//	          port: 2222
+//	      vars:
+//	        sudo: false
+func ParseYAML(data []byte) (*Inventory, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	inv := newInventory()
+	if len(root.Content) == 0 {
+		return inv, inv.finish()
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of groups", doc.Line)
+	}
+	// the mapping keeps the file order of the hosts
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if err := inv.parseYAMLGroup(doc.Content[i].Value, doc.Content[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return inv, inv.finish()
+}
+
+func (inv *Inventory) parseYAMLGroup(name string, node *yaml.Node) error {
+	g := inv.group(name)
+	if isNull(node) {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: group %q: expected a mapping", node.Line, name)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case "hosts":
+			if isNull(value) {
+				continue
+			}
+			if value.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: group %q: hosts must be a mapping", value.Line, name)
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				vars, err := yamlVars(value.Content[j+1])
+				if err != nil {
+					return err
+				}
+				inv.addHost(name, value.Content[j].Value, vars)
+			}
+		case "vars":
+			vars, err := yamlVars(value)
+			if err != nil {
+				return err
+			}
+			for k, v := range vars {
+				g.Vars[k] = v
+			}
+		case "children":
+			if isNull(value) {
+				continue
+			}
+			if value.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: group %q: children must be a mapping", value.Line, name)
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				child := value.Content[j].Value
+				inv.addChild(name, child)
+				if err := inv.parseYAMLGroup(child, value.Content[j+1]); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("line %d: group %q: unknown key %q (expected hosts, vars, children)", key.Line, name, key.Value)
+		}
+	}
+	return nil
+}
+
+// yamlVars reads a mapping of variables, the values are scalars or lists of scalars
+func yamlVars(node *yaml.Node) (map[string][]string, error) {
+	vars := map[string][]string{}
+	if isNull(node) {
+		return vars, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of variables", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch value.Kind {
+		case yaml.ScalarNode:
+			vars[key.Value] = []string{value.Value}
+		case yaml.SequenceNode:
+			values := make([]string, 0, len(value.Content))
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("line %d: variable %q: expected a list of values", item.Line, key.Value)
+				}
+				values = append(values, item.Value)
+			}
+			vars[key.Value] = values
+		default:
+			return nil, fmt.Errorf("line %d: variable %q: expected a value or a list of values", value.Line, key.Value)
+		}
+	}
+	return vars, nil
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
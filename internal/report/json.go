@@ -0,0 +1,85 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/runner"
+)
+
+type jsonReport struct {
+	RunID      string     `json:"run_id"`
+	Status     string     `json:"status"`
+	Start      time.Time  `json:"start"`
+	End        time.Time  `json:"end"`
+	DurationMs int64      `json:"duration_ms"`
+	Hosts      []jsonHost `json:"hosts"`
+}
+
+type jsonHost struct {
+	Host       string       `json:"host"`
+	Status     string       `json:"status"`
+	Error      string       `json:"error,omitempty"`
+	Start      time.Time    `json:"start"`
+	End        time.Time    `json:"end"`
+	DurationMs int64        `json:"duration_ms"`
+	Scripts    []jsonScript `json:"scripts"`
+}
+
+type jsonScript struct {
+	Script     string    `json:"script"`
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs int64     `json:"duration_ms"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+}
+
+// WriteJSON writes the result as an indented JSON document.
+func WriteJSON(w io.Writer, result *runner.Result) error {
+	report := jsonReport{
+		RunID:      result.RunID,
+		Status:     string(runner.StatusSuccess),
+		Start:      result.Start,
+		End:        result.End,
+		DurationMs: result.Duration.Milliseconds(),
+		Hosts:      make([]jsonHost, 0, len(result.Hosts)),
+	}
+	if result.Err() != nil {
+		report.Status = string(runner.StatusFailed)
+	}
+
+	for _, h := range result.Hosts {
+		host := jsonHost{
+			Host:       h.Host,
+			Status:     string(h.Status),
+			Error:      h.Error,
+			Start:      h.Start,
+			End:        h.End,
+			DurationMs: h.Duration.Milliseconds(),
+			Scripts:    make([]jsonScript, 0, len(h.Scripts)),
+		}
+		for _, s := range h.Scripts {
+			host.Scripts = append(host.Scripts, jsonScript{
+				Script:     s.Script,
+				Status:     string(s.Status),
+				ExitCode:   s.ExitCode,
+				Error:      s.Error,
+				Start:      s.Start,
+				End:        s.End,
+				DurationMs: s.Duration.Milliseconds(),
+				Stdout:     s.Stdout,
+				Stderr:     s.Stderr,
+			})
+		}
+		report.Hosts = append(report.Hosts, host)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,140 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/runner"
+)
+
+// JUnit XML layout understood by Jenkins and GitLab: a test suite per host, a test case per script.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the result as a JUnit XML document.
+// A host that could not be connected is reported as a 'connect' test case with an error; a host that stopped
+// before any script failed (e.g. the remote directory could not be created, or the run was canceled) is reported
+// as a 'host' test case with an error. Skipped hosts (e.g. in a dry run) are not errors.
+func WriteJUnit(w io.Writer, result *runner.Result) error {
+	report := junitTestSuites{
+		Name: "rconf",
+		Time: seconds(result.Duration),
+	}
+
+	for _, h := range result.Hosts {
+		suite := junitTestSuite{
+			Name:      h.Host,
+			Time:      seconds(h.Duration),
+			Timestamp: h.Start.Format(time.RFC3339),
+		}
+
+		if h.Status != runner.StatusSuccess && h.Status != runner.StatusSkipped && !hasFailedScript(h) {
+			name := "host"
+			if h.Status == runner.StatusConnFailed {
+				name = "connect"
+			}
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      name,
+				ClassName: h.Host,
+				Time:      seconds(h.Duration),
+				Error:     &junitMessage{Message: string(h.Status), Type: string(h.Status), Text: h.Error},
+			})
+			suite.Errors++
+		}
+
+		for _, s := range h.Scripts {
+			tc := junitTestCase{
+				Name:      s.Script,
+				ClassName: h.Host,
+				Time:      seconds(s.Duration),
+				SystemOut: s.Stdout,
+				SystemErr: s.Stderr,
+			}
+			switch s.Status {
+			case runner.StatusSuccess:
+			case runner.StatusSkipped:
+				tc.Skipped = &junitMessage{Message: s.Error}
+				suite.Skipped++
+			default:
+				tc.Failure = &junitMessage{
+					Message: fmt.Sprintf("exit status %d", s.ExitCode),
+					Type:    string(s.Status),
+					Text:    s.Error,
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// hasFailedScript reports whether a script of the host is reported as a failure
+func hasFailedScript(h *runner.HostResult) bool {
+	for _, s := range h.Scripts {
+		if s.Status != runner.StatusSuccess && s.Status != runner.StatusSkipped {
+			return true
+		}
+	}
+	return false
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,74 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hashmap-kz/rconf/internal/runner"
+)
+
+// Report formats
+const (
+	FormatJSON  = "json"
+	FormatJUnit = "junit"
+)
+
+// Spec is a report requested with --report FORMAT=PATH.
+type Spec struct {
+	Format string
+	Path   string
+}
+
+// ParseSpecs parses the report specs (e.g. 'json=report.json', 'junit=junit.xml').
+// They are checked before the run, so that a typo does not waste a rollout.
+func ParseSpecs(specs []string) ([]Spec, error) {
+	result := make([]Spec, 0, len(specs))
+	for _, s := range specs {
+		format, path, ok := strings.Cut(s, "=")
+		if !ok || strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("invalid report: %q (expected FORMAT=PATH)", s)
+		}
+		switch format {
+		case FormatJSON, FormatJUnit:
+		default:
+			return nil, fmt.Errorf("unknown report format: %q (available: %s, %s)", format, FormatJSON, FormatJUnit)
+		}
+		result = append(result, Spec{Format: format, Path: path})
+	}
+	return result, nil
+}
+
+// WriteAll writes every requested report.
+func WriteAll(specs []Spec, result *runner.Result) error {
+	for _, spec := range specs {
+		if err := writeFile(spec, result); err != nil {
+			return fmt.Errorf("failed to write %s report: %w", spec.Format, err)
+		}
+	}
+	return nil
+}
+
+func writeFile(spec Spec, result *runner.Result) error {
+	f, err := os.Create(spec.Path)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, spec.Format, result); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the report in the given format.
+func Write(w io.Writer, format string, result *runner.Result) error {
+	switch format {
+	case FormatJSON:
+		return WriteJSON(w, result)
+	case FormatJUnit:
+		return WriteJUnit(w, result)
+	}
+	return fmt.Errorf("unknown report format: %q", format)
+}
@@ -0,0 +1,193 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testResult() *runner.Result {
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	return &runner.Result{
+		RunID:    "20250301T100000-8f3a1c2e",
+		Start:    start,
+		End:      start.Add(5 * time.Second),
+		Duration: 5 * time.Second,
+		Hosts: []*runner.HostResult{
+			{
+				Host:     "10.40.240.189:22",
+				Status:   runner.StatusFailed,
+				Start:    start,
+				End:      start.Add(3 * time.Second),
+				Duration: 3 * time.Second,
+				Scripts: []*runner.ScriptResult{
+					{
+						Script: "scripts/00-packages.sh", Status: runner.StatusSuccess, ExitCode: 0,
+						Start: start, End: start.Add(time.Second), Duration: time.Second,
+						Stdout: "installed\n",
+					},
+					{
+						Script: "scripts/01-timezone.sh", Status: runner.StatusFailed, ExitCode: 3,
+						Start: start.Add(time.Second), End: start.Add(3 * time.Second), Duration: 2 * time.Second,
+						Stdout: "", Stderr: "timedatectl: <not found>\n", Error: "failed to execute script: Process exited with status 3",
+					},
+				},
+			},
+			{
+				Host:     "10.40.240.193:22",
+				Status:   runner.StatusConnFailed,
+				Start:    start,
+				End:      start.Add(time.Second),
+				Duration: time.Second,
+				Error:    "failed to dial SSH: connection refused",
+			},
+		},
+	}
+}
+
+func TestParseSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    []Spec
+		wantErr bool
+	}{
+		{"No reports", nil, []Spec{}, false},
+		{"JSON and JUnit", []string{"json=out/report.json", "junit=junit.xml"}, []Spec{{"json", "out/report.json"}, {"junit", "junit.xml"}}, false},
+		{"Missing path", []string{"json="}, nil, true},
+		{"Missing format", []string{"report.json"}, nil, true},
+		{"Unknown format", []string{"yaml=report.yaml"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSpecs(tt.specs)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, testResult()))
+
+	var got jsonReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+
+	assert.Equal(t, "20250301T100000-8f3a1c2e", got.RunID)
+	assert.Equal(t, "Failed", got.Status)
+	assert.Equal(t, int64(5000), got.DurationMs)
+	require.Len(t, got.Hosts, 2)
+
+	host := got.Hosts[0]
+	assert.Equal(t, "10.40.240.189:22", host.Host)
+	require.Len(t, host.Scripts, 2)
+	assert.Equal(t, "scripts/00-packages.sh", host.Scripts[0].Script)
+	assert.Equal(t, "installed\n", host.Scripts[0].Stdout)
+	assert.Equal(t, 3, host.Scripts[1].ExitCode)
+	assert.Equal(t, "timedatectl: <not found>\n", host.Scripts[1].Stderr)
+	assert.Equal(t, int64(2000), host.Scripts[1].DurationMs)
+	assert.Equal(t, time.Date(2025, 3, 1, 10, 0, 3, 0, time.UTC), host.Scripts[1].End)
+
+	assert.Equal(t, "Connection Failed", got.Hosts[1].Status)
+	assert.Equal(t, "failed to dial SSH: connection refused", got.Hosts[1].Error)
+	assert.Empty(t, got.Hosts[1].Scripts)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJUnit(&buf, testResult()))
+	assert.Contains(t, buf.String(), xml.Header)
+
+	var got junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &got))
+
+	assert.Equal(t, 3, got.Tests)
+	assert.Equal(t, 1, got.Failures)
+	assert.Equal(t, 1, got.Errors)
+	assert.Equal(t, "5.000", got.Time)
+	require.Len(t, got.Suites, 2)
+
+	suite := got.Suites[0]
+	assert.Equal(t, "10.40.240.189:22", suite.Name)
+	assert.Equal(t, "2025-03-01T10:00:00Z", suite.Timestamp)
+	require.Len(t, suite.Cases, 2)
+	assert.Nil(t, suite.Cases[0].Failure)
+	assert.Equal(t, "installed\n", suite.Cases[0].SystemOut)
+	require.NotNil(t, suite.Cases[1].Failure)
+	assert.Equal(t, "exit status 3", suite.Cases[1].Failure.Message)
+	assert.Equal(t, "timedatectl: <not found>\n", suite.Cases[1].SystemErr)
+
+	conn := got.Suites[1]
+	require.Len(t, conn.Cases, 1)
+	assert.Equal(t, "connect", conn.Cases[0].Name)
+	require.NotNil(t, conn.Cases[0].Error)
+	assert.Equal(t, "failed to dial SSH: connection refused", conn.Cases[0].Error.Text)
+}
+
+func TestWriteJUnitHostErrors(t *testing.T) {
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	result := &runner.Result{Hosts: []*runner.HostResult{
+		// failed before its first script
+		{Host: "10.40.240.189:22", Status: runner.StatusFailed, Start: start, Error: "failed to create remote directory: permission denied"},
+		// canceled before its scripts ran
+		{Host: "10.40.240.190:22", Status: runner.StatusCanceled, Start: start, Error: "canceled by interrupt signal", Scripts: []*runner.ScriptResult{
+			{Script: "scripts/00-packages.sh", Status: runner.StatusSkipped, Error: "canceled by interrupt signal"},
+		}},
+		// not started: skipped, not an error
+		{Host: "10.40.240.191:22", Status: runner.StatusSkipped, Start: start, Error: "dry run"},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteJUnit(&buf, result))
+	var got junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &got))
+
+	assert.Equal(t, 2, got.Errors)
+	require.Len(t, got.Suites, 3)
+
+	failed := got.Suites[0]
+	assert.Equal(t, 1, failed.Errors)
+	require.Len(t, failed.Cases, 1)
+	assert.Equal(t, "host", failed.Cases[0].Name)
+	require.NotNil(t, failed.Cases[0].Error)
+	assert.Equal(t, "Failed", failed.Cases[0].Error.Type)
+	assert.Equal(t, "failed to create remote directory: permission denied", failed.Cases[0].Error.Text)
+
+	canceled := got.Suites[1]
+	assert.Equal(t, 1, canceled.Errors)
+	assert.Equal(t, 1, canceled.Skipped)
+	require.Len(t, canceled.Cases, 2)
+	assert.Equal(t, "canceled by interrupt signal", canceled.Cases[0].Error.Text)
+
+	assert.Zero(t, got.Suites[2].Errors)
+	assert.Empty(t, got.Suites[2].Cases)
+}
+
+func TestWriteAll(t *testing.T) {
+	dir := t.TempDir()
+	specs := []Spec{{FormatJSON, filepath.Join(dir, "report.json")}, {FormatJUnit, filepath.Join(dir, "junit.xml")}}
+	require.NoError(t, WriteAll(specs, testResult()))
+
+	for _, s := range specs {
+		info, err := os.Stat(s.Path)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Size())
+	}
+
+	err := WriteAll([]Spec{{FormatJSON, filepath.Join(dir, "missing", "report.json")}}, testResult())
+	assert.Error(t, err)
+}
@@ -10,23 +10,39 @@ import (
 	"strings"
 )
 
+// FileExtensions are the extensions of the scripts taken from directories by default (--ext)
 var FileExtensions = []string{".sh"}
 
-func ResolveAllFiles(filenames []string, recursive bool) ([]string, error) {
+// TemplateExtension marks the scripts rendered as templates (e.g. 'install.sh.tmpl')
+const TemplateExtension = ".tmpl"
+
+// ResolveAllFiles expands the given inputs into an ordered list of files.
+//
+// The order is explicit and stable: inputs are processed in the order they were given,
+// files expanded from a single directory or glob are sorted lexically, and a file that
+// was already resolved by an earlier input is not repeated.
+// This keeps mixed local/URL inputs in the order the user passed them.
+// Files from directories are kept when they have one of the extensions (all files when empty).
+func ResolveAllFiles(filenames []string, recursive bool, extensions []string) ([]string, error) {
 	result := []string{}
+	seen := make(map[string]bool)
 	for _, f := range filenames {
-		files, err := resolveFilenamesForPatterns(f, recursive)
+		files, err := resolveFilenamesForPatterns(f, recursive, extensions)
 		if err != nil {
 			return nil, fmt.Errorf("error resolving filenames: %w", err)
 		}
-		result = append(result, files...)
+		for _, file := range files {
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+			result = append(result, file)
+		}
 	}
-	// Ensure consistent order
-	sort.Strings(result)
 	return result, nil
 }
 
-func resolveFilenamesForPatterns(path string, recursive bool) ([]string, error) {
+func resolveFilenamesForPatterns(path string, recursive bool, extensions []string) ([]string, error) {
 	var results []string
 
 	// Check if the path is a URL
@@ -58,7 +74,7 @@ func resolveFilenamesForPatterns(path string, recursive bool) ([]string, error)
 					return filepath.SkipDir
 				}
 				if !d.IsDir() {
-					if !ignoreFile(filepath.Clean(p), FileExtensions) {
+					if !ignoreFile(filepath.Clean(p), extensions) {
 						results = append(results, filepath.Clean(p))
 					}
 				}
@@ -87,7 +103,8 @@ func ignoreFile(path string, allowedExtensions []string) bool {
 	if len(allowedExtensions) == 0 {
 		return false
 	}
-	ext := filepath.Ext(path)
+	// templates are selected by the extension of the rendered script
+	ext := filepath.Ext(strings.TrimSuffix(path, TemplateExtension))
 	for _, s := range allowedExtensions {
 		if s == ext {
 			return false
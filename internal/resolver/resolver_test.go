@@ -42,7 +42,7 @@ func TestResolveFilenames2(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			result, err := resolveFilenamesForPatterns(test.path, test.recursive)
+			result, err := resolveFilenamesForPatterns(test.path, test.recursive, FileExtensions)
 			if test.expectError {
 				assert.Error(t, err)
 			} else {
@@ -82,6 +82,8 @@ func TestIgnoreFile(t *testing.T) {
 		{"Allowed Extension", "file.sh", []string{".sh"}, false},
 		{"Disallowed Extension", "file.txt", []string{".sh"}, true},
 		{"Empty Extensions", "file.sh", []string{}, false},
+		{"Template", "file.sh.tmpl", []string{".sh"}, false},
+		{"Disallowed Template", "file.txt.tmpl", []string{".sh"}, true},
 	}
 
 	for _, tt := range tests {
@@ -123,7 +125,7 @@ func TestResolveAllFiles(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ResolveAllFiles(tt.filenames, tt.recursive)
+			got, err := ResolveAllFiles(tt.filenames, tt.recursive, FileExtensions)
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -133,3 +135,70 @@ func TestResolveAllFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveAllFilesExtensions(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"00-setup.sh", "01-app.py", "02-motd.py.tmpl", "notes.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(tempDir, name), []byte("test content"), 0o600))
+	}
+
+	tests := []struct {
+		name       string
+		extensions []string
+		want       []string
+	}{
+		{"Default", FileExtensions, []string{"00-setup.sh"}},
+		{"Shell and Python", []string{".sh", ".py"}, []string{"00-setup.sh", "01-app.py", "02-motd.py.tmpl"}},
+		{"Python only", []string{".py"}, []string{"01-app.py", "02-motd.py.tmpl"}},
+		{"All files", nil, []string{"00-setup.sh", "01-app.py", "02-motd.py.tmpl", "notes.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveAllFiles([]string{tempDir}, false, tt.extensions)
+			assert.NoError(t, err)
+			want := make([]string, 0, len(tt.want))
+			for _, name := range tt.want {
+				want = append(want, filepath.Join(tempDir, name))
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+}
+func TestResolveAllFilesOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	dirA := filepath.Join(tempDir, "b-dir")
+	dirB := filepath.Join(tempDir, "a-dir")
+	assert.NoError(t, os.Mkdir(dirA, 0o755))
+	assert.NoError(t, os.Mkdir(dirB, 0o755))
+
+	names := []string{"10-users.sh", "02-locale.sh", "00-packages.sh", "01-timezone.sh"}
+	for _, name := range names {
+		assert.NoError(t, os.WriteFile(filepath.Join(dirA, name), []byte("test content"), 0o600))
+	}
+	single := filepath.Join(dirB, "99-last.sh")
+	assert.NoError(t, os.WriteFile(single, []byte("test content"), 0o600))
+
+	inputs := []string{
+		"https://example.com/zz-first.sh",
+		dirA,
+		single,
+		"http://example.com/aa-last.sh",
+		filepath.Join(dirA, "02-locale.sh"), // already resolved, must not be repeated
+	}
+	want := []string{
+		"https://example.com/zz-first.sh",
+		filepath.Join(dirA, "00-packages.sh"),
+		filepath.Join(dirA, "01-timezone.sh"),
+		filepath.Join(dirA, "02-locale.sh"),
+		filepath.Join(dirA, "10-users.sh"),
+		single,
+		"http://example.com/aa-last.sh",
+	}
+
+	for i := 0; i < 100; i++ {
+		got, err := ResolveAllFiles(inputs, true, FileExtensions)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
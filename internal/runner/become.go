@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashmap-kz/rconf/internal/cmd"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+	"golang.org/x/term"
+)
+
+// becomePassEnv holds the sudo password when neither --ask-become-pass nor --become-pass-file is used.
+const becomePassEnv = "RCONF_BECOME_PASS"
+
+// promptBecomePass asks for the sudo password on the terminal, without echo (replaced in tests).
+var promptBecomePass = func() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("--ask-become-pass needs a terminal")
+	}
+	fmt.Fprint(os.Stderr, "BECOME password: ")
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the become password: %w", err)
+	}
+	return string(pass), nil
+}
+
+// loadBecomePass returns the sudo password of all hosts: prompted (--ask-become-pass), read from --become-pass-file,
+// or from RCONF_BECOME_PASS. It is empty when none is given: sudo must not ask for a password.
+func loadBecomePass(cfg *cmd.Config) (string, error) {
+	switch {
+	case cfg.AskBecomePass:
+		return promptBecomePass()
+	case cfg.BecomePassFile != "":
+		return readBecomePassFile(cfg.BecomePassFile)
+	}
+	return os.Getenv(becomePassEnv), nil
+}
+
+// readBecomePassFile returns the first line of the file
+func readBecomePassFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read become password file: %w", err)
+	}
+	pass, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSuffix(pass, "\r"), nil
+}
+
+// withBecome returns the opts of a host with the escalation method and user of all hosts (--become, --become-user),
+// unless the host sets them. The opts are copied when changed.
+func withBecome(opts map[string][]string, method, user string) map[string][]string {
+	setMethod := method != "" && len(opts["become"]) == 0 && len(opts["sudo"]) == 0
+	setUser := user != "" && len(opts["become_user"]) == 0
+	if !setMethod && !setUser {
+		return opts
+	}
+	withMethod := maps.Clone(opts)
+	if withMethod == nil {
+		withMethod = map[string][]string{}
+	}
+	if setMethod {
+		withMethod["become"] = []string{method}
+	}
+	if setUser {
+		withMethod["become_user"] = []string{user}
+	}
+	return withMethod
+}
+
+// withBecomePass returns the opts of a host with its sudo password: the become_pass opt,
+// the become_pass_file opt, or the password of all hosts.
+// The opts are copied, the password file opt is replaced by the password.
+func withBecomePass(opts map[string][]string, pass string) (map[string][]string, error) {
+	if len(opts[rconf.BecomePassOpt]) > 0 {
+		return opts, nil
+	}
+	if file := opts["become_pass_file"]; len(file) > 0 {
+		filePass, err := readBecomePassFile(file[len(file)-1])
+		if err != nil {
+			return nil, err
+		}
+		pass = filePass
+	}
+	if pass == "" {
+		return opts, nil
+	}
+	withPass := maps.Clone(opts)
+	if withPass == nil {
+		withPass = map[string][]string{}
+	}
+	delete(withPass, "become_pass_file")
+	withPass[rconf.BecomePassOpt] = []string{pass}
+	return withPass, nil
+}
+
+// checkBecome checks the escalation opts of every script on every host (the header of a script may set them)
+func checkBecome(tasks []*HostTask) error {
+	for _, task := range tasks {
+		for _, script := range task.Scripts {
+			if err := rconf.ValidateBecome(scriptOpts(task, script)); err != nil {
+				return fmt.Errorf("%s: %w (host %s)", filepath.ToSlash(script.Path), err, task.Result.Host)
+			}
+		}
+	}
+	return nil
+}
+
+// remoteDirMode returns the mode of the remote directory of the host: private to the login user,
+// or traversable when a script runs as another user (its name is not listed)
+func remoteDirMode(task *HostTask) os.FileMode {
+	for _, script := range task.Scripts {
+		if rconf.BecomeUser(scriptOpts(task, script)) != "" {
+			return 0o711
+		}
+	}
+	return 0o700
+}
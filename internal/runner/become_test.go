@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashmap-kz/rconf/internal/cmd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBecomePass(t *testing.T) {
+	prev := promptBecomePass
+	promptBecomePass = func() (string, error) { return "prompted", nil }
+	t.Cleanup(func() { promptBecomePass = prev })
+	t.Setenv(becomePassEnv, "from-env")
+
+	file := filepath.Join(t.TempDir(), "become-pass")
+	require.NoError(t, os.WriteFile(file, []byte("from-file\r\nignored\n"), 0o600))
+
+	tests := []struct {
+		name string
+		cfg  cmd.Config
+		want string
+	}{
+		{name: "ask", cfg: cmd.Config{AskBecomePass: true}, want: "prompted"},
+		{name: "file", cfg: cmd.Config{BecomePassFile: file}, want: "from-file"},
+		{name: "env", want: "from-env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadBecomePass(&tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := loadBecomePass(&cmd.Config{BecomePassFile: filepath.Join(t.TempDir(), "missing")})
+	assert.ErrorContains(t, err, "failed to read become password file")
+}
+
+func TestWithBecomePass(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "web-pass")
+	require.NoError(t, os.WriteFile(file, []byte("web-secret\n"), 0o600))
+
+	tests := []struct {
+		name string
+		opts map[string][]string
+		want map[string][]string
+	}{
+		{name: "global", opts: nil, want: map[string][]string{"become_pass": {"global"}}},
+		{name: "host", opts: map[string][]string{"become_pass": {"host"}}, want: map[string][]string{"become_pass": {"host"}}},
+		{
+			name: "host file",
+			opts: map[string][]string{"become_pass_file": {file}, "sudo": {"true"}},
+			want: map[string][]string{"become_pass": {"web-secret"}, "sudo": {"true"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withBecomePass(tt.opts, "global")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// no password: the opts are kept
+	opts := map[string][]string{"sudo": {"true"}}
+	got, err := withBecomePass(opts, "")
+	require.NoError(t, err)
+	assert.Equal(t, opts, got)
+
+	_, err = withBecomePass(map[string][]string{"become_pass_file": {filepath.Join(t.TempDir(), "missing")}}, "")
+	assert.Error(t, err)
+}
+
+func TestWithBecome(t *testing.T) {
+	assert.Nil(t, withBecome(nil, "", ""))
+	assert.Equal(t, map[string][]string{"become": {"doas"}, "become_user": {"postgres"}}, withBecome(nil, "doas", "postgres"))
+
+	// the host wins
+	opts := map[string][]string{"sudo": {"false"}, "become_user": {"www"}}
+	assert.Equal(t, opts, withBecome(opts, "doas", "postgres"))
+	opts = map[string][]string{"become": {"su"}}
+	assert.Equal(t, map[string][]string{"become": {"su"}, "become_user": {"postgres"}}, withBecome(opts, "doas", "postgres"))
+	assert.Equal(t, map[string][]string{"become": {"su"}}, opts)
+}
+
+func TestScriptBecome(t *testing.T) {
+	script := Script{Path: "db/01-init.sh", Opts: map[string][]string{"become": {"doas"}, "become_user": {"postgres"}}}
+
+	task := &HostTask{Scripts: []Script{script}, Result: &HostResult{Host: "db1:22"}}
+	assert.Equal(t, script.Opts, scriptOpts(task, script))
+	assert.Equal(t, os.FileMode(0o711), remoteDirMode(task))
+	assert.NoError(t, checkBecome([]*HostTask{task}))
+
+	// sudo=false on the host wins over the become of the script
+	task.Opts = map[string][]string{"sudo": {"false"}}
+	assert.Equal(t, map[string][]string{"sudo": {"false"}, "become_user": {"postgres"}}, scriptOpts(task, script))
+	assert.Equal(t, os.FileMode(0o700), remoteDirMode(task))
+
+	// sudo reads the password, doas cannot
+	task.Opts = map[string][]string{"become_pass": {"secret"}}
+	assert.EqualError(t, checkBecome([]*HostTask{task}),
+		"db/01-init.sh: a become password is only supported with become=sudo (got doas) (host db1:22)")
+
+	assert.Equal(t, os.FileMode(0o700), remoteDirMode(&HostTask{Scripts: []Script{{Path: "00-ok.sh"}}}))
+}
@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+)
+
+// directivePrefix starts the header lines with the settings of a script:
+//
+//	#!/bin/sh
+//	# rconf: sudo=false timeout=5m retries=2 tags=db,init
+//	# rconf: run_once=true
+const directivePrefix = "rconf:"
+
+// directiveKeys are the settings a script may declare in its header.
+var directiveKeys = []string{"become", "become_user", "interpreter", "on_error", "retries", "run_once", "sudo", "tags", "timeout"}
+
+// parseDirectives reads the '# rconf:' lines of the script header (the leading comments and blank lines)
+// into the script settings. Later lines win.
+func parseDirectives(script *Script) error {
+	name := filepath.ToSlash(script.Path)
+	scanner := bufio.NewScanner(bytes.NewReader(script.Content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		comment, ok := strings.CutPrefix(text, "#")
+		if !ok {
+			break
+		}
+		settings, ok := strings.CutPrefix(strings.TrimSpace(comment), directivePrefix)
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Fields(settings) {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok || value == "" {
+				return fmt.Errorf("%s:%d: invalid rconf directive %q (expected key=value)", name, line, field)
+			}
+			if err := script.setDirective(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// setDirective applies a header setting to the script
+func (s *Script) setDirective(key, value string) error {
+	switch key {
+	case "sudo", "run_once":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid rconf directive %s=%q (expected true or false)", key, value)
+		}
+		if key == "run_once" {
+			s.RunOnce = b
+			return nil
+		}
+		s.setOpt(key, strconv.FormatBool(b))
+	case "interpreter", "become_user":
+		s.setOpt(key, value)
+	case "become":
+		if err := rconf.ValidateBecome(map[string][]string{key: {value}}); err != nil {
+			return fmt.Errorf("invalid rconf directive become=%q", value)
+		}
+		s.setOpt(key, value)
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid rconf directive timeout=%q (expected a duration, e.g. 5m)", value)
+		}
+		s.Timeout = d
+	case "retries":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid rconf directive retries=%q (expected a number)", value)
+		}
+		s.Retries = n
+	case "tags":
+		s.Tags = nil
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				s.Tags = append(s.Tags, tag)
+			}
+		}
+	case "on_error":
+		if value != OnErrorStop && value != OnErrorContinue {
+			return fmt.Errorf("invalid rconf directive on_error=%q (expected %s or %s)", value, OnErrorStop, OnErrorContinue)
+		}
+		s.OnError = value
+	default:
+		return fmt.Errorf("unknown rconf directive %q (known: %s)", key, strings.Join(directiveKeys, ", "))
+	}
+	return nil
+}
+
+func (s *Script) setOpt(key, value string) {
+	if s.Opts == nil {
+		s.Opts = map[string][]string{}
+	}
+	s.Opts[key] = []string{value}
+}
+
+// scriptOpts returns the opts the script runs with: the host opts, completed by the header of the script.
+// sudo and become are the same setting: the script keeps none of them when the host sets one.
+func scriptOpts(task *HostTask, script Script) map[string][]string {
+	if len(script.Opts) == 0 {
+		return task.Opts
+	}
+	opts := maps.Clone(script.Opts)
+	if len(task.Opts["sudo"]) > 0 || len(task.Opts["become"]) > 0 {
+		delete(opts, "sudo")
+		delete(opts, "become")
+	}
+	maps.Copy(opts, task.Opts)
+	return opts
+}
+
+// scriptTimeout returns the time limit of the script: --script-timeout (or the host opt) wins over the header
+func scriptTimeout(task *HostTask, script Script) time.Duration {
+	if task.ScriptTimeout > 0 {
+		return task.ScriptTimeout
+	}
+	return script.Timeout
+}
+
+// filterTags keeps the scripts tagged with one of tags (all scripts when empty), without one of skipTags
+func filterTags(scripts []Script, tags, skipTags []string) ([]Script, error) {
+	if len(tags) == 0 && len(skipTags) == 0 {
+		return scripts, nil
+	}
+	hasTag := func(script Script, tags []string) bool {
+		return slices.ContainsFunc(script.Tags, func(tag string) bool { return slices.Contains(tags, tag) })
+	}
+	var selected []Script
+	for _, script := range scripts {
+		if len(tags) > 0 && !hasTag(script, tags) || hasTag(script, skipTags) {
+			continue
+		}
+		selected = append(selected, script)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no scripts selected (tags: %q, skipped tags: %q)", tags, skipTags)
+	}
+	return selected, nil
+}
+
+// runOnce assigns the run_once scripts to the first host that reaches them, shared by the hosts.
+// A nil runOnce runs the scripts on every host.
+type runOnce struct {
+	mu     sync.Mutex
+	owners map[string]string // script path -> host
+}
+
+func newRunOnce() *runOnce {
+	return &runOnce{owners: map[string]string{}}
+}
+
+// claim returns the host that runs the script, and whether it is this host
+func (r *runOnce) claim(script, host string) (string, bool) {
+	if r == nil {
+		return host, true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	owner, ok := r.owners[script]
+	if !ok {
+		r.owners[script] = host
+		return host, true
+	}
+	return owner, owner == host
+}
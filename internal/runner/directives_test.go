@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDirectives(t *testing.T) {
+	script := &Script{Path: "db/01-init.sh", Content: []byte(`#!/bin/bash
+# Initializes the database.
+# rconf: sudo=false timeout=5m retries=2 tags=db,init
+#rconf: interpreter=/bin/bash run_once=true on_error=continue
+
+echo hello
+# rconf: sudo=true
+`)}
+
+	require.NoError(t, parseDirectives(script))
+	assert.Equal(t, map[string][]string{"sudo": {"false"}, "interpreter": {"/bin/bash"}}, script.Opts)
+	assert.Equal(t, 5*time.Minute, script.Timeout)
+	assert.Equal(t, 2, script.Retries)
+	assert.Equal(t, []string{"db", "init"}, script.Tags)
+	assert.True(t, script.RunOnce)
+	assert.Equal(t, OnErrorContinue, script.OnError)
+
+	plain := &Script{Path: "02-plain.sh", Content: []byte("#!/bin/sh\necho rconf: sudo=false\n")}
+	require.NoError(t, parseDirectives(plain))
+	assert.Equal(t, Script{Path: plain.Path, Content: plain.Content}, *plain)
+}
+
+func TestParseDirectivesErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		wantErr string
+	}{
+		{"# rconf: runas=root", `01.sh:1: unknown rconf directive "runas" (known: become, become_user, interpreter, on_error, retries, run_once, sudo, tags, timeout)`},
+		{"# rconf: become=root", `01.sh:1: invalid rconf directive become="root"`},
+		{"#!/bin/sh\n\n# rconf: sudo", `01.sh:3: invalid rconf directive "sudo" (expected key=value)`},
+		{"# rconf: sudo=maybe", `01.sh:1: invalid rconf directive sudo="maybe" (expected true or false)`},
+		{"# rconf: timeout=soon", `01.sh:1: invalid rconf directive timeout="soon"`},
+		{"# rconf: retries=-1", `01.sh:1: invalid rconf directive retries="-1"`},
+		{"# rconf: on_error=ignore", `01.sh:1: invalid rconf directive on_error="ignore"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			err := parseDirectives(&Script{Path: "01.sh", Content: []byte(tt.content)})
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestScriptOverrides(t *testing.T) {
+	script := Script{Opts: map[string][]string{"sudo": {"false"}, "interpreter": {"/bin/bash"}}, Timeout: time.Minute}
+
+	// the host opts and --script-timeout win over the header
+	task := &HostTask{Opts: map[string][]string{"sudo": {"true"}}, ScriptTimeout: time.Second}
+	assert.Equal(t, map[string][]string{"sudo": {"true"}, "interpreter": {"/bin/bash"}}, scriptOpts(task, script))
+	assert.Equal(t, time.Second, scriptTimeout(task, script))
+
+	task = &HostTask{}
+	assert.Equal(t, script.Opts, scriptOpts(task, script))
+	assert.Equal(t, time.Minute, scriptTimeout(task, script))
+}
+
+func TestFilterTags(t *testing.T) {
+	scripts := []Script{{Path: "a.sh", Tags: []string{"db", "init"}}, {Path: "b.sh", Tags: []string{"web"}}, {Path: "c.sh"}}
+	paths := func(scripts []Script) []string {
+		var names []string
+		for _, s := range scripts {
+			names = append(names, s.Path)
+		}
+		return names
+	}
+
+	got, err := filterTags(scripts, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.sh", "b.sh", "c.sh"}, paths(got))
+
+	got, err = filterTags(scripts, []string{"db", "web"}, []string{"init"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.sh"}, paths(got))
+
+	got, err = filterTags(scripts, nil, []string{"web"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.sh", "c.sh"}, paths(got))
+
+	_, err = filterTags(scripts, []string{"cache"}, nil)
+	assert.ErrorContains(t, err, "no scripts selected")
+}
+
+// flakyClient fails the first executions of every script
+type flakyClient struct {
+	fakeClient
+	failuresLeft int
+}
+
+func (f *flakyClient) ExecuteScript(ctx context.Context, remotePath string, opts map[string][]string, stream *rconf.Stream) (*rconf.ExecResult, error) {
+	output, err := f.fakeClient.ExecuteScript(ctx, remotePath, opts, stream)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil && f.failuresLeft > 0 {
+		f.failuresLeft--
+		return output, errors.New("flaky")
+	}
+	return output, err
+}
+
+func TestProcessHostRetries(t *testing.T) {
+	tests := []struct {
+		retries  int
+		failures int
+		want     Status
+		runs     int
+	}{
+		{retries: 0, failures: 1, want: StatusFailed, runs: 1},
+		{retries: 2, failures: 2, want: StatusSuccess, runs: 3},
+		{retries: 2, failures: 5, want: StatusFailed, runs: 3},
+	}
+	for _, tt := range tests {
+		client := &flakyClient{failuresLeft: tt.failures}
+		useFakeClient(t, client)
+
+		result := runTestHost([]Script{{Path: "00-flaky.sh", Retries: tt.retries}})
+
+		assert.Equal(t, tt.want, result.Status)
+		assert.Len(t, client.executed, tt.runs)
+	}
+}
+
+func TestProcessHostRunOnce(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+
+	var wg sync.WaitGroup
+	once := newRunOnce()
+	scripts := []Script{{Path: "00-migrate.sh", RunOnce: true}, {Path: "01-all.sh"}}
+	var results []*HostResult
+	for _, host := range []string{"10.0.0.1", "10.0.0.2"} {
+		task := &HostTask{
+			Host: host, Port: "22", Scripts: scripts, Result: &HostResult{Host: host + ":22"},
+			RemoteDir: "/tmp", wg: &wg, semaphore: make(chan struct{}, 1), once: once,
+		}
+		results = append(results, task.Result)
+		wg.Add(1)
+		processHost(context.Background(), task)
+	}
+	wg.Wait()
+
+	assert.Equal(t, StatusSuccess, results[0].Scripts[0].Status)
+	assert.Equal(t, StatusSkipped, results[1].Scripts[0].Status)
+	assert.Equal(t, "run_once: runs on 10.0.0.1:22", results[1].Scripts[0].Error)
+	assert.Equal(t, StatusSuccess, results[1].Scripts[1].Status)
+	assert.Equal(t, StatusSuccess, results[1].Status)
+	assert.Equal(t, []string{"/tmp/00-migrate.sh", "/tmp/01-all.sh", "/tmp/01-all.sh"}, client.executed)
+}
@@ -0,0 +1,182 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+)
+
+// plannedScript is a script of the dry-run plan of a host.
+type plannedScript struct {
+	Path       string
+	RemotePath string // empty for an ad-hoc command
+	Command    string
+	SHA256     string // of the rendered content
+	Err        error  // the template could not be rendered
+}
+
+// planHost builds the plan of a host without uploading or executing anything.
+//
+// With connect set, the host is connected and authenticated first (and its facts gathered when the templates use them);
+// otherwise the facts are empty. The scripts are recorded as skipped (or failed when they cannot be rendered).
+func planHost(ctx context.Context, task *HostTask, connect bool) {
+	defer task.wg.Done()
+
+	hostResult := task.Result
+	hostResult.Start = time.Now()
+	defer hostResult.finish()
+
+	data := task.TemplateData
+	if data == nil {
+		data = &templateData{}
+	}
+	withFacts := *data
+	withFacts.Facts = placeholderFacts()
+
+	if connect {
+		if facts, ok := checkHost(ctx, task); ok {
+			hostResult.Status = StatusSuccess
+			if facts != nil {
+				withFacts.Facts = facts
+			}
+		}
+	} else {
+		hostResult.Status = StatusSkipped
+	}
+
+	for _, script := range task.Scripts {
+		planned := &plannedScript{
+			Path:       filepath.ToSlash(script.Path),
+			RemotePath: remoteScriptPath(task.RemoteDir, script),
+		}
+		planned.Command = rconf.ScriptCommand(planned.RemotePath, execOpts(task, script))
+		if script.Command != "" {
+			planned.RemotePath = ""
+			planned.Command = rconf.CommandLine(script.Command, execOpts(task, script))
+		}
+		scriptResult := &ScriptResult{Script: planned.Path, Status: StatusSkipped, ExitCode: -1, Start: time.Now(), Error: "dry run"}
+
+		content, err := renderScript(script, &withFacts)
+		if err != nil {
+			planned.Err = err
+			scriptResult.Status = StatusFailed
+			scriptResult.Error = err.Error()
+			if hostResult.Status == StatusSuccess || hostResult.Status == StatusSkipped {
+				hostResult.Status = StatusFailed
+			}
+		} else {
+			sum := sha256.Sum256(content)
+			planned.SHA256 = hex.EncodeToString(sum[:])
+		}
+		scriptResult.finish()
+		hostResult.Scripts = append(hostResult.Scripts, scriptResult)
+		task.plan = append(task.plan, planned)
+	}
+}
+
+// checkHost connects to the host (and gathers its facts when the templates use them).
+// It returns false when the host could not be reached, with the host status and error set.
+func checkHost(ctx context.Context, task *HostTask) (map[string]string, bool) {
+	hostResult := task.Result
+	hostInfoLog := hostResult.Host
+
+	select {
+	case task.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		hostResult.Status = stopStatus(ctx)
+		hostResult.Error = context.Cause(ctx).Error()
+		return nil, false
+	}
+	defer func() { <-task.semaphore }()
+
+	if task.HostTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, task.HostTimeout, fmt.Errorf("host timeout (%s) exceeded", task.HostTimeout))
+		defer cancel()
+	}
+
+	fmt.Printf("[HOST: %s] 🔄 Checking connection...\n", hostInfoLog)
+	client, err := newSSHClient(ctx, connstr.ConnInfo{
+		User:     task.User,
+		Password: task.Password,
+		Host:     task.Host,
+		Port:     task.Port,
+		Opts:     task.Opts,
+		Jumps:    task.Jumps,
+
+		IdentityFiles: task.IdentityFiles,
+	}, task.SSHOptions)
+	if err != nil {
+		slogger.Error("SSH connection failed", slog.String("host", hostInfoLog), slog.Any("error", err))
+		fmt.Printf("[HOST: %s] ❌ SSH connection failed\n", hostInfoLog)
+		if ctx.Err() != nil {
+			hostResult.Status = stopStatus(ctx)
+			hostResult.Error = context.Cause(ctx).Error()
+		} else {
+			hostResult.Status = StatusConnFailed
+			hostResult.Error = err.Error()
+		}
+		return nil, false
+	}
+	defer client.Close()
+
+	if !task.GatherFacts {
+		fmt.Printf("[HOST: %s] ✅ Connection OK\n", hostInfoLog)
+		return nil, true
+	}
+	facts, err := gatherFacts(ctx, client)
+	if err != nil {
+		slogger.Error("Failed to gather facts", slog.String("host", hostInfoLog), slog.Any("error", err))
+		fmt.Printf("[HOST: %s] ❌ Failed to gather facts\n", hostInfoLog)
+		hostResult.Status = StatusFailed
+		hostResult.Error = fmt.Sprintf("failed to gather facts: %s", err)
+		return nil, false
+	}
+	fmt.Printf("[HOST: %s] ✅ Connection OK\n", hostInfoLog)
+	return facts, true
+}
+
+// printPlans prints the plan of every host, in the input order
+func printPlans(w io.Writer, tasks []*HostTask, connect bool) {
+	for _, task := range tasks {
+		hostResult := task.Result
+		fmt.Fprintf(w, "\n[HOST: %s] 📋 Plan for %s@%s", hostResult.Host, task.User, hostResult.Host)
+		switch {
+		case !connect:
+			fmt.Fprintln(w, " (connection not checked)")
+		case hostResult.Error != "":
+			fmt.Fprintf(w, " (❌ %s)\n", hostResult.Error)
+		default:
+			fmt.Fprintln(w, " (connection OK)")
+		}
+		if len(task.Jumps) > 0 {
+			hops := make([]string, 0, len(task.Jumps))
+			for _, hop := range task.Jumps {
+				hops = append(hops, hop.User+"@"+net.JoinHostPort(hop.Host, hop.Port))
+			}
+			fmt.Fprintf(w, "  via: %s\n", strings.Join(hops, " -> "))
+		}
+		for i, p := range task.plan {
+			fmt.Fprintf(w, "  %d. %s\n", i+1, p.Path)
+			if p.Err != nil {
+				fmt.Fprintf(w, "     ❌ %s\n", p.Err)
+				continue
+			}
+			if p.RemotePath != "" {
+				fmt.Fprintf(w, "     remote:  %s\n", p.RemotePath)
+			}
+			fmt.Fprintf(w, "     command: %s\n", p.Command)
+			fmt.Fprintf(w, "     sha256:  %s\n", p.SHA256)
+		}
+	}
+}
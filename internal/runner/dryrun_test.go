@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runTestPlan plans the task as a single host
+func runTestPlan(task *HostTask, connect bool) *HostResult {
+	var wg sync.WaitGroup
+	task.User, task.Host, task.Port = "deploy", "localhost", "22"
+	task.RemoteDir, task.RunID = "/tmp", "run1"
+	task.Result = &HostResult{Host: "localhost:22"}
+	task.wg = &wg
+	task.semaphore = make(chan struct{}, 1)
+	wg.Add(1)
+	planHost(context.Background(), task, connect)
+	wg.Wait()
+	return task.Result
+}
+
+func TestPlanHost(t *testing.T) {
+	connected := false
+	useFakeClient(t, nil)
+	newSSHClient = func(_ context.Context, _ connstr.ConnInfo, _ *rconf.Options) (sshClient, error) {
+		connected = true
+		return &fakeClient{}, nil
+	}
+
+	scripts := []Script{
+		{Path: "00-plain.sh", Content: []byte("echo ok\n")},
+		{Path: "01-motd.sh.tmpl", Content: []byte("echo {{ .Host }}\n")},
+	}
+	require.NoError(t, parseTemplates(scripts, false))
+	task := &HostTask{
+		Scripts:      scripts,
+		Opts:         map[string][]string{"sudo": {"false"}},
+		TemplateData: newTemplateData(&hostEntry{Name: "web1", ConnInfo: &connstr.ConnInfo{}}, nil),
+	}
+
+	result := runTestPlan(task, false)
+
+	assert.False(t, connected)
+	assert.Equal(t, StatusSkipped, result.Status)
+	require.Len(t, result.Scripts, 2)
+	assert.Equal(t, StatusSkipped, result.Scripts[0].Status)
+	assert.Equal(t, []*plannedScript{
+		{
+			Path:       "00-plain.sh",
+			RemotePath: "/tmp/00-plain.sh",
+			Command:    "chmod +x '/tmp/00-plain.sh' && env 'RCONF_HOST=localhost' 'RCONF_RUN_ID=run1' 'RCONF_SCRIPT=00-plain.sh' '/tmp/00-plain.sh'",
+			SHA256:     "4726de74e6ad02ddb5decee701960c06c6fd91a871f95238350941eed7dbb22a",
+		},
+		{
+			Path:       "01-motd.sh.tmpl",
+			RemotePath: "/tmp/01-motd.sh",
+			Command:    "chmod +x '/tmp/01-motd.sh' && env 'RCONF_HOST=localhost' 'RCONF_RUN_ID=run1' 'RCONF_SCRIPT=01-motd.sh.tmpl' '/tmp/01-motd.sh'",
+			SHA256:     "35af48124980445ca985246801c1d56cc41b8ad915610de3c8eef92b5d1f9be5",
+		},
+	}, task.plan)
+
+	var out bytes.Buffer
+	printPlans(&out, []*HostTask{task}, false)
+	assert.Contains(t, out.String(), "[HOST: localhost:22] 📋 Plan for deploy@localhost:22 (connection not checked)")
+	assert.Contains(t, out.String(), "  2. 01-motd.sh.tmpl\n     remote:  /tmp/01-motd.sh\n")
+}
+
+func TestPlanHostConnect(t *testing.T) {
+	client := &fakeClient{stdout: "distro=debian\n"}
+	useFakeClient(t, client)
+
+	scripts := []Script{{Path: "00-distro.sh.tmpl", Content: []byte("echo {{ .Facts.distro }}")}}
+	require.NoError(t, parseTemplates(scripts, false))
+	task := &HostTask{
+		Scripts:      scripts,
+		TemplateData: newTemplateData(&hostEntry{Name: "web1", ConnInfo: &connstr.ConnInfo{}}, nil),
+		GatherFacts:  true,
+	}
+
+	result := runTestPlan(task, true)
+
+	assert.Equal(t, StatusSuccess, result.Status)
+	assert.Equal(t, []string{factsCommand}, client.commands)
+	assert.Empty(t, client.uploaded)
+	assert.Empty(t, client.executed)
+	// rendered with the gathered facts
+	assert.Equal(t, "cb8bffc8eac160222a839beb3001ee5eb2b6b0b616e0f56be8f8f2c41f25e28a", task.plan[0].SHA256)
+	assert.Equal(t, "sudo chmod +x '/tmp/00-distro.sh' && sudo env 'RCONF_HOST=localhost' 'RCONF_RUN_ID=run1' 'RCONF_SCRIPT=00-distro.sh.tmpl' '/tmp/00-distro.sh'", task.plan[0].Command)
+
+	var out bytes.Buffer
+	printPlans(&out, []*HostTask{task}, true)
+	assert.Contains(t, out.String(), "(connection OK)")
+}
+
+func TestPlanHostConnectionFailed(t *testing.T) {
+	useFakeClient(t, nil)
+	newSSHClient = func(_ context.Context, _ connstr.ConnInfo, _ *rconf.Options) (sshClient, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	task := &HostTask{Scripts: []Script{{Path: "00-ok.sh"}}}
+	result := runTestPlan(task, true)
+
+	assert.Equal(t, StatusConnFailed, result.Status)
+	assert.Equal(t, "connection refused", result.Error)
+	// the plan is still shown
+	assert.Len(t, task.plan, 1)
+
+	var out bytes.Buffer
+	printPlans(&out, []*HostTask{task}, true)
+	assert.Contains(t, out.String(), "(❌ connection refused)")
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+)
+
+// Variables set for every script, they win over --env, --env-file and the env.NAME opts.
+const (
+	envHost   = "RCONF_HOST"
+	envRunID  = "RCONF_RUN_ID"
+	envScript = "RCONF_SCRIPT"
+)
+
+// loadEnv returns the environment of the scripts on all hosts: the KEY=VAL lines of the files
+// (later files win), then the pairs.
+func loadEnv(files, pairs []string) (map[string]string, error) {
+	env := map[string]string{}
+	for _, f := range files {
+		fileEnv, err := readEnvFile(f)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(env, fileEnv)
+	}
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --env: %q (expected KEY=VAL)", p)
+		}
+		if err := rconf.ValidateEnvName(k); err != nil {
+			return nil, err
+		}
+		env[k] = v
+	}
+	return env, nil
+}
+
+// readEnvFile reads the KEY=VAL lines of the file; blank lines, '#' comments and the 'export ' prefix are skipped,
+// and the quotes around a value are removed.
+func readEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	env := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		k = strings.TrimSpace(k)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: invalid line (expected KEY=VAL)", filepath.ToSlash(path), line)
+		}
+		if err := rconf.ValidateEnvName(k); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filepath.ToSlash(path), line, err)
+		}
+		env[k] = unquote(strings.TrimSpace(v))
+	}
+	return env, scanner.Err()
+}
+
+// unquote removes the matching single or double quotes around the value
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// withEnv returns the opts of a host with the environment and the positional parameters of all hosts,
+// the env.NAME and args opts of the host win. The opts are copied when changed.
+func withEnv(opts map[string][]string, env map[string]string, args []string) map[string][]string {
+	setArgs := len(args) > 0 && len(opts[rconf.ArgsOpt]) == 0
+	if len(env) == 0 && !setArgs {
+		return opts
+	}
+	withVars := maps.Clone(opts)
+	if withVars == nil {
+		withVars = map[string][]string{}
+	}
+	for k, v := range env {
+		if _, ok := opts[rconf.EnvOptPrefix+k]; !ok {
+			withVars[rconf.EnvOptPrefix+k] = []string{v}
+		}
+	}
+	if setArgs {
+		withVars[rconf.ArgsOpt] = args
+	}
+	return withVars
+}
+
+// execOpts returns the opts the script (or the ad-hoc command) is executed with: the opts of the script
+// and the RCONF_* variables of the run.
+func execOpts(task *HostTask, script Script) map[string][]string {
+	opts := maps.Clone(scriptOpts(task, script))
+	if opts == nil {
+		opts = map[string][]string{}
+	}
+	opts[rconf.EnvOptPrefix+envHost] = []string{task.Host}
+	opts[rconf.EnvOptPrefix+envRunID] = []string{task.RunID}
+	opts[rconf.EnvOptPrefix+envScript] = []string{filepath.ToSlash(script.Path)}
+	return opts
+}
@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEnv(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.env")
+	prod := filepath.Join(dir, "prod.env")
+	require.NoError(t, os.WriteFile(base, []byte(`# defaults
+APP_ENV=dev
+export DB_HOST = "db.local"
+
+GREETING='hello world'
+EMPTY=
+`), 0o600))
+	require.NoError(t, os.WriteFile(prod, []byte("APP_ENV=prod\r\nURL=https://x/?a=b\n"), 0o600))
+
+	env, err := loadEnv([]string{base, prod}, []string{"DB_HOST=db1", "TOKEN=a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"APP_ENV":  "prod",
+		"DB_HOST":  "db1",
+		"GREETING": "hello world",
+		"EMPTY":    "",
+		"URL":      "https://x/?a=b",
+		"TOKEN":    "a=b",
+	}, env)
+}
+
+func TestLoadEnvErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.env")
+	require.NoError(t, os.WriteFile(invalid, []byte("A=1\nB-C=2\n"), 0o600))
+	noValue := filepath.Join(dir, "novalue.env")
+	require.NoError(t, os.WriteFile(noValue, []byte("A\n"), 0o600))
+
+	tests := []struct {
+		files   []string
+		pairs   []string
+		wantErr string
+	}{
+		{pairs: []string{"A"}, wantErr: `invalid --env: "A" (expected KEY=VAL)`},
+		{pairs: []string{"=1"}, wantErr: "invalid environment variable name"},
+		{files: []string{invalid}, wantErr: "invalid.env:2: invalid environment variable name"},
+		{files: []string{noValue}, wantErr: "novalue.env:1: invalid line (expected KEY=VAL)"},
+		{files: []string{filepath.Join(dir, "missing.env")}, wantErr: "failed to read env file"},
+	}
+	for _, tt := range tests {
+		_, err := loadEnv(tt.files, tt.pairs)
+		assert.ErrorContains(t, err, tt.wantErr)
+	}
+}
+
+func TestWithEnv(t *testing.T) {
+	hostOpts := map[string][]string{"env.APP_ENV": {"staging"}, "sudo": {"false"}}
+	env := map[string]string{"APP_ENV": "prod", "DB_HOST": "db1"}
+
+	got := withEnv(hostOpts, env, []string{"--force"})
+	assert.Equal(t, map[string][]string{
+		"env.APP_ENV": {"staging"},
+		"env.DB_HOST": {"db1"},
+		"args":        {"--force"},
+		"sudo":        {"false"},
+	}, got)
+	// the opts of the host are not changed
+	assert.Len(t, hostOpts, 2)
+
+	assert.Equal(t, []string{"host"}, withEnv(map[string][]string{"args": {"host"}}, nil, []string{"--force"})["args"])
+	assert.Equal(t, hostOpts, withEnv(hostOpts, nil, nil))
+}
+
+func TestProcessHostEnv(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+
+	task := &HostTask{
+		RunID: "20261016T120000-0011aabb",
+		Opts:  map[string][]string{"env.APP_ENV": {"prod"}, "env.RCONF_HOST": {"spoofed"}},
+		Scripts: []Script{
+			{Path: "db/01-init.sh", Opts: map[string][]string{"sudo": {"false"}}},
+		},
+	}
+	result := runTestTask(context.Background(), task)
+
+	require.Equal(t, StatusSuccess, result.Status)
+	assert.Equal(t, map[string][]string{
+		"env.APP_ENV":      {"prod"},
+		"env.RCONF_HOST":   {"localhost"},
+		"env.RCONF_RUN_ID": {"20261016T120000-0011aabb"},
+		"env.RCONF_SCRIPT": {"db/01-init.sh"},
+		"sudo":             {"false"},
+	}, client.opts["/tmp/db/01-init.sh"])
+	// the opts of the host and the script are not changed
+	assert.Len(t, task.Opts, 2)
+	assert.Len(t, task.Scripts[0].Opts, 1)
+}
@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"context"
+	"strings"
+)
+
+// factKeys are the facts gathered from a host, when a template uses them
+var factKeys = []string{"hostname", "fqdn", "os", "kernel", "arch", "distro", "distro_version", "ip"}
+
+// factsCommand prints the facts as key=value lines, missing tools leave the values empty
+const factsCommand = `echo "hostname=$(hostname -s 2>/dev/null || hostname)"
+echo "fqdn=$(hostname -f 2>/dev/null || hostname)"
+echo "os=$(uname -s)"
+echo "kernel=$(uname -r)"
+echo "arch=$(uname -m)"
+if [ -r /etc/os-release ]; then (. /etc/os-release; echo "distro=$ID"; echo "distro_version=$VERSION_ID"); fi
+echo "ip=$(hostname -I 2>/dev/null | awk '{print $1}')"
+`
+
+// gatherFacts runs the facts command on the host
+func gatherFacts(ctx context.Context, client sshClient) (map[string]string, error) {
+	output, err := client.RunCommand(ctx, factsCommand)
+	if err != nil {
+		return nil, err
+	}
+	return parseFacts(output.Stdout), nil
+}
+
+// parseFacts reads the key=value lines of the known facts, every fact is set (possibly empty)
+func parseFacts(output string) map[string]string {
+	facts := placeholderFacts()
+	for _, line := range strings.Split(output, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if _, known := facts[k]; ok && known {
+			facts[k] = v
+		}
+	}
+	return facts
+}
+
+// placeholderFacts returns the known facts with empty values
+func placeholderFacts() map[string]string {
+	facts := make(map[string]string, len(factKeys))
+	for _, k := range factKeys {
+		facts[k] = ""
+	}
+	return facts
+}
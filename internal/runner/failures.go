@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// failureLimit stops the scheduling of new hosts once more hosts failed than allowed (--fail-fast, --max-fail).
+// A nil limit never stops.
+type failureLimit struct {
+	allowed int // failed hosts tolerated
+
+	mu      sync.Mutex
+	failed  int
+	reached chan struct{} // closed when the limit is exceeded
+}
+
+func newFailureLimit(allowed int) *failureLimit {
+	return &failureLimit{allowed: allowed, reached: make(chan struct{})}
+}
+
+// parseMaxFail returns the number of failed hosts tolerated out of total: 'N' or 'P%' of the hosts (rounded down),
+// -1 when there's no limit. --fail-fast tolerates none.
+func parseMaxFail(failFast bool, maxFail string, total int) (int, error) {
+	if failFast {
+		return 0, nil
+	}
+	maxFail = strings.TrimSpace(maxFail)
+	if maxFail == "" {
+		return -1, nil
+	}
+	if p, ok := strings.CutSuffix(maxFail, "%"); ok {
+		percent, err := strconv.ParseFloat(p, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, fmt.Errorf("invalid --max-fail: %q (expected N or P%%, 0-100%%)", maxFail)
+		}
+		return int(float64(total) * percent / 100), nil
+	}
+	n, err := strconv.Atoi(maxFail)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid --max-fail: %q (expected N or P%%)", maxFail)
+	}
+	return n, nil
+}
+
+// record counts the host when it failed (canceled and skipped hosts are not failures)
+func (l *failureLimit) record(status Status) {
+	if l == nil {
+		return
+	}
+	switch status {
+	case StatusFailed, StatusConnFailed, StatusTimeout:
+	default:
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failed++
+	if l.failed == l.allowed+1 {
+		close(l.reached)
+	}
+}
+
+// done returns a channel closed when the limit is exceeded (nil for no limit: never ready)
+func (l *failureLimit) done() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.reached
+}
+
+// exceeded returns the reason to skip new hosts, or an empty string
+func (l *failureLimit) exceeded() string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failed <= l.allowed {
+		return ""
+	}
+	return fmt.Sprintf("not started: failed hosts: %d (allowed: %d)", l.failed, l.allowed)
+}
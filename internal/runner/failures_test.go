@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMaxFail(t *testing.T) {
+	tests := []struct {
+		failFast bool
+		maxFail  string
+		total    int
+		want     int
+		wantErr  bool
+	}{
+		{maxFail: "", total: 10, want: -1},
+		{failFast: true, maxFail: "5", total: 10, want: 0},
+		{maxFail: "3", total: 10, want: 3},
+		{maxFail: "0", total: 10, want: 0},
+		{maxFail: "25%", total: 10, want: 2},
+		{maxFail: "100%", total: 10, want: 10},
+		{maxFail: "10%", total: 5, want: 0},
+		{maxFail: "-1", wantErr: true},
+		{maxFail: "abc", wantErr: true},
+		{maxFail: "150%", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%t %s", tt.failFast, tt.maxFail), func(t *testing.T) {
+			got, err := parseMaxFail(tt.failFast, tt.maxFail, tt.total)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// runTestHosts processes the hosts one at a time, every host fails
+func runTestHosts(t *testing.T, count int, failures *failureLimit) []*HostResult {
+	t.Helper()
+	useFakeClient(t, &fakeClient{failures: map[string]error{"/tmp/00-fail.sh": errors.New("boom")}})
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 1)
+	results := make([]*HostResult, 0, count)
+	for i := 0; i < count; i++ {
+		task := &HostTask{
+			Host:      fmt.Sprintf("10.0.0.%d", i+1),
+			Port:      "22",
+			RemoteDir: "/tmp",
+			Scripts:   []Script{{Path: "00-fail.sh"}, {Path: "01-ok.sh"}},
+			Result:    &HostResult{Host: fmt.Sprintf("10.0.0.%d:22", i+1)},
+			wg:        &wg,
+			semaphore: sem,
+			failures:  failures,
+		}
+		results = append(results, task.Result)
+		wg.Add(1)
+		go processHost(context.Background(), task)
+	}
+	wg.Wait()
+	return results
+}
+
+func countStatuses(results []*HostResult) map[Status]int {
+	counts := map[Status]int{}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	return counts
+}
+
+func TestProcessHostFailFast(t *testing.T) {
+	results := runTestHosts(t, 5, newFailureLimit(0))
+
+	assert.Equal(t, map[Status]int{StatusFailed: 1, StatusSkipped: 4}, countStatuses(results))
+	for _, r := range results {
+		if r.Status != StatusSkipped {
+			continue
+		}
+		assert.Equal(t, "not started: failed hosts: 1 (allowed: 0)", r.Error)
+		require.Len(t, r.Scripts, 2)
+		assert.Equal(t, StatusSkipped, r.Scripts[0].Status)
+	}
+	// skipped hosts are not failures
+	assert.Equal(t, 1, (&Result{Hosts: results}).Err().(*RunError).Failed)
+}
+
+func TestProcessHostMaxFail(t *testing.T) {
+	results := runTestHosts(t, 5, newFailureLimit(2))
+	assert.Equal(t, map[Status]int{StatusFailed: 3, StatusSkipped: 2}, countStatuses(results))
+
+	// no limit
+	results = runTestHosts(t, 5, nil)
+	assert.Equal(t, map[Status]int{StatusFailed: 5}, countStatuses(results))
+}
@@ -0,0 +1,188 @@
+package runner
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"os/user"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/cmd"
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/hashmap-kz/rconf/internal/inventory"
+	"github.com/hashmap-kz/rconf/internal/sshconfig"
+)
+
+// loadSSHConfig parses the OpenSSH client config files ('none' disables them).
+func loadSSHConfig(path string) (*sshconfig.Config, error) {
+	switch path {
+	case "none":
+		return nil, nil
+	case "":
+		return sshconfig.Load(sshconfig.DefaultPaths()...)
+	}
+	return sshconfig.Load(path)
+}
+
+// resolveConnInfo parses the connection string and fills the gaps from the ssh config.
+// Explicit values win, then the config, then the defaults used by ssh: the local user and port 22.
+// The jump hosts come from the 'jump' query-opt (or ProxyJump), or the default chain.
+func resolveConnInfo(connStr string, sshCfg *sshconfig.Config, defaultJump string) (*connstr.ConnInfo, error) {
+	connInfo, err := connstr.ParsePartialConnectionString(connStr)
+	if err != nil {
+		return nil, err
+	}
+	return completeConnInfo(connInfo, connStr, sshCfg, defaultJump)
+}
+
+// completeConnInfo fills the gaps in partial connection details (see resolveConnInfo),
+// the name is used in the errors.
+func completeConnInfo(connInfo *connstr.ConnInfo, name string, sshCfg *sshconfig.Config, defaultJump string) (*connstr.ConnInfo, error) {
+	var err error
+	if sshCfg != nil {
+		sshCfg.Apply(connInfo)
+	}
+	if connInfo.User == "" {
+		if u, err := user.Current(); err == nil {
+			connInfo.User = u.Username
+		}
+	}
+	if connInfo.Port == "" {
+		connInfo.Port = connstr.DefaultPort
+	}
+	if err := connInfo.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	jump := defaultJump
+	if v := connInfo.Opts["jump"]; len(v) > 0 {
+		jump = v[len(v)-1]
+	}
+	connInfo.Jumps, err = resolveJumps(jump, sshCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return connInfo, nil
+}
+
+// hostEntry is a resolved host with the variables available to the script templates.
+type hostEntry struct {
+	Name     string // the host as given: the --conn host (or ssh config alias), or the inventory name
+	ConnInfo *connstr.ConnInfo
+	Groups   []string            // inventory groups
+	Vars     map[string][]string // inventory variables, or the query-opts of a --conn host
+}
+
+// resolveHosts returns the --conn hosts (with their patterns expanded), then the inventory hosts
+// selected by the limit. A host given twice is an error.
+func resolveHosts(cfg *cmd.Config, sshCfg *sshconfig.Config) ([]*hostEntry, error) {
+	if cfg.Limit != "" && cfg.Inventory == "" {
+		return nil, fmt.Errorf("--limit requires --inventory")
+	}
+
+	connStrs, err := connstr.ExpandConnectionStrings(cfg.ConnStrings)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]*hostEntry, 0, len(connStrs))
+	for _, connStr := range connStrs {
+		partial, err := connstr.ParsePartialConnectionString(connStr)
+		if err != nil {
+			return nil, err
+		}
+		name, vars := partial.Host, maps.Clone(partial.Opts)
+		connInfo, err := completeConnInfo(partial, connStr, sshCfg, cfg.Jump)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, &hostEntry{Name: name, ConnInfo: connInfo, Vars: vars})
+	}
+
+	if cfg.Inventory != "" {
+		hosts, err = appendInventoryHosts(hosts, cfg, sshCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkDuplicateHosts(hosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// appendInventoryHosts appends the inventory hosts selected by the limit
+func appendInventoryHosts(hosts []*hostEntry, cfg *cmd.Config, sshCfg *sshconfig.Config) ([]*hostEntry, error) {
+	inv, err := inventory.Load(cfg.Inventory)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := inv.Select(cfg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range selected {
+		connInfo, err := completeConnInfo(h.ConnInfo(), h.Name, sshCfg, cfg.Jump)
+		if err != nil {
+			return nil, fmt.Errorf("inventory: %w", err)
+		}
+		hosts = append(hosts, &hostEntry{Name: h.Name, ConnInfo: connInfo, Groups: h.Groups, Vars: h.Vars})
+	}
+	return hosts, nil
+}
+
+// checkDuplicateHosts reports the hosts (host:port) given more than once, e.g. by overlapping patterns
+func checkDuplicateHosts(hosts []*hostEntry) error {
+	seen := map[string]bool{}
+	var duplicates []string
+	for _, h := range hosts {
+		key := net.JoinHostPort(h.ConnInfo.Host, h.ConnInfo.Port)
+		if seen[key] && !slices.Contains(duplicates, key) {
+			duplicates = append(duplicates, key)
+		}
+		seen[key] = true
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("duplicate hosts: %s", strings.Join(duplicates, ", "))
+	}
+	return nil
+}
+
+// resolveJumps parses a ProxyJump-like chain: 'user@bastion:port,user@inner' ('none' for a direct connection).
+// The hops are connected in the given order, their own ProxyJump settings are not followed.
+func resolveJumps(spec string, sshCfg *sshconfig.Config) ([]*connstr.ConnInfo, error) {
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+	var hops []*connstr.ConnInfo
+	for _, hop := range strings.Split(spec, ",") {
+		hop = strings.TrimSpace(hop)
+		if hop == "" {
+			return nil, fmt.Errorf("invalid jump hosts: %q", spec)
+		}
+		hopInfo, err := resolveConnInfo(hop, sshCfg, "none")
+		if err != nil {
+			return nil, fmt.Errorf("invalid jump host: %w", err)
+		}
+		delete(hopInfo.Opts, "jump")
+		hopInfo.Jumps = nil
+		hops = append(hops, hopInfo)
+	}
+	return hops, nil
+}
+
+// durationOpt returns the duration from the query-opt (e.g. '?script_timeout=90s'), or the default.
+// A zero duration means no limit.
+func durationOpt(opts map[string][]string, key string, def time.Duration) (time.Duration, error) {
+	v := opts[key]
+	if len(v) == 0 {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v[len(v)-1])
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s: %q (expected a duration like 30s, 5m)", key, v[len(v)-1])
+	}
+	return d, nil
+}
@@ -0,0 +1,212 @@
+package runner
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/cmd"
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/hashmap-kz/rconf/internal/sshconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveConnInfo(t *testing.T) {
+	sshCfg, err := sshconfig.Parse(strings.NewReader(`
+Host db-prod-1
+    HostName 10.40.240.10
+    User postgres
+
+Host db-prod-2
+    HostName 10.40.240.11
+    User postgres
+    ProxyJump admin@bastion:2222
+
+Host bastion
+    HostName 10.40.240.1
+    ProxyJump outer
+`))
+	require.NoError(t, err)
+
+	localUser, err := user.Current()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		connStr string
+		sshCfg  *sshconfig.Config
+		jump    string
+		want    *connstr.ConnInfo
+		wantErr bool
+	}{
+		{
+			name:    "Alias from ssh config",
+			connStr: "db-prod-1",
+			sshCfg:  sshCfg,
+			want:    &connstr.ConnInfo{User: "postgres", Host: "10.40.240.10", Port: "22", Opts: map[string][]string{}},
+		},
+		{
+			name:    "Explicit user and port win",
+			connStr: "root@db-prod-1:2222?sudo=false",
+			sshCfg:  sshCfg,
+			want:    &connstr.ConnInfo{User: "root", Host: "10.40.240.10", Port: "2222", Opts: map[string][]string{"sudo": {"false"}}},
+		},
+		{
+			name:    "Local user without ssh config",
+			connStr: "10.0.0.1",
+			want:    &connstr.ConnInfo{User: localUser.Username, Host: "10.0.0.1", Port: "22", Opts: map[string][]string{}},
+		},
+		{
+			name:    "Default jump host",
+			connStr: "root@10.0.0.1",
+			sshCfg:  sshCfg,
+			jump:    "admin@bastion",
+			want: &connstr.ConnInfo{
+				User: "root", Host: "10.0.0.1", Port: "22", Opts: map[string][]string{},
+				Jumps: []*connstr.ConnInfo{
+					{User: "admin", Host: "10.40.240.1", Port: "22", Opts: map[string][]string{}},
+				},
+			},
+		},
+		{
+			name:    "Jump chain from query-opt wins",
+			connStr: "root@10.0.0.1?jump=admin@bastion,ops:secret@inner:2200",
+			sshCfg:  sshCfg,
+			jump:    "admin@other",
+			want: &connstr.ConnInfo{
+				User: "root", Host: "10.0.0.1", Port: "22", Opts: map[string][]string{"jump": {"admin@bastion,ops:secret@inner:2200"}},
+				Jumps: []*connstr.ConnInfo{
+					{User: "admin", Host: "10.40.240.1", Port: "22", Opts: map[string][]string{}},
+					{User: "ops", Password: "secret", Host: "inner", Port: "2200", Opts: map[string][]string{}},
+				},
+			},
+		},
+		{
+			name:    "Jump host from ProxyJump",
+			connStr: "db-prod-2",
+			sshCfg:  sshCfg,
+			want: &connstr.ConnInfo{
+				User: "postgres", Host: "10.40.240.11", Port: "22", Opts: map[string][]string{"jump": {"admin@bastion:2222"}},
+				Jumps: []*connstr.ConnInfo{
+					{User: "admin", Host: "10.40.240.1", Port: "2222", Opts: map[string][]string{}},
+				},
+			},
+		},
+		{
+			name:    "Jump disabled per host",
+			connStr: "root@10.0.0.1?jump=none",
+			jump:    "admin@bastion",
+			want:    &connstr.ConnInfo{User: "root", Host: "10.0.0.1", Port: "22", Opts: map[string][]string{"jump": {"none"}}},
+		},
+		{
+			name:    "Invalid jump chain",
+			connStr: "root@10.0.0.1?jump=admin@bastion,,",
+			wantErr: true,
+		},
+		{
+			name:    "Missing host",
+			connStr: "user@:22",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveConnInfo(tt.connStr, tt.sshCfg, tt.jump)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDurationOpt(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    map[string][]string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"Default", map[string][]string{}, time.Minute, false},
+		{"Override", map[string][]string{"script_timeout": {"90s"}}, 90 * time.Second, false},
+		{"Last value wins", map[string][]string{"script_timeout": {"90s", "5m"}}, 5 * time.Minute, false},
+		{"No limit", map[string][]string{"script_timeout": {"0"}}, 0, false},
+		{"Invalid", map[string][]string{"script_timeout": {"soon"}}, 0, true},
+		{"Negative", map[string][]string{"script_timeout": {"-1s"}}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := durationOpt(tt.opts, "script_timeout", time.Minute)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolveHostsInventory(t *testing.T) {
+	invPath := filepath.Join(t.TempDir(), "hosts.ini")
+	require.NoError(t, os.WriteFile(invPath, []byte(`
+[web]
+web1 host=10.0.1.11 user=deploy
+web2 host=10.0.1.12 user=deploy port=2222 sudo=false
+
+[db]
+db1 host=10.0.2.11 user=postgres jump=admin@10.0.0.1
+`), 0o600))
+
+	hosts, err := resolveHosts(&cmd.Config{
+		ConnStrings: []string{"root@10.0.9.1"},
+		Inventory:   invPath,
+		Limit:       "web,db,!web1",
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, hosts, 3)
+
+	assert.Equal(t, "10.0.9.1", hosts[0].ConnInfo.Host)
+	assert.Equal(t, &connstr.ConnInfo{
+		User: "deploy", Host: "10.0.1.12", Port: "2222",
+		Opts: map[string][]string{"sudo": {"false"}},
+	}, hosts[1].ConnInfo)
+	assert.Equal(t, "web2", hosts[1].Name)
+	assert.Equal(t, []string{"web"}, hosts[1].Groups)
+	assert.Equal(t, []string{"2222"}, hosts[1].Vars["port"])
+	assert.Equal(t, "postgres", hosts[2].ConnInfo.User)
+	assert.Equal(t, "22", hosts[2].ConnInfo.Port)
+	require.Len(t, hosts[2].ConnInfo.Jumps, 1)
+	assert.Equal(t, "10.0.0.1", hosts[2].ConnInfo.Jumps[0].Host)
+
+	_, err = resolveHosts(&cmd.Config{Inventory: invPath, Limit: "cache"}, nil)
+	assert.Error(t, err)
+
+	_, err = resolveHosts(&cmd.Config{ConnStrings: []string{"root@10.0.9.1"}, Limit: "web"}, nil)
+	assert.Error(t, err)
+}
+
+func TestResolveHostsPatterns(t *testing.T) {
+	hosts, err := resolveHosts(&cmd.Config{ConnStrings: []string{"root@10.0.1.[1:4]", "!10.0.1.3"}}, nil)
+	require.NoError(t, err)
+	var got []string
+	for _, h := range hosts {
+		got = append(got, h.ConnInfo.Host)
+	}
+	assert.Equal(t, []string{"10.0.1.1", "10.0.1.2", "10.0.1.4"}, got)
+
+	_, err = resolveHosts(&cmd.Config{ConnStrings: []string{"root@10.0.1.[1:4]", "deploy@10.0.1.2:22", "root@10.0.1.4"}}, nil)
+	assert.EqualError(t, err, "duplicate hosts: 10.0.1.2:22, 10.0.1.4:22")
+
+	// the same address on another port is another host
+	_, err = resolveHosts(&cmd.Config{ConnStrings: []string{"root@10.0.1.1", "root@10.0.1.1:2222"}}, nil)
+	assert.NoError(t, err)
+}
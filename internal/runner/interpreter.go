@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashmap-kz/rconf/internal/resolver"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+)
+
+// parseExtensions returns the extensions of the scripts taken from directories (--ext): '.sh,py' -> [.sh .py]
+func parseExtensions(exts []string) []string {
+	if len(exts) == 0 {
+		return resolver.FileExtensions
+	}
+	var normalized []string
+	for _, ext := range exts {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			normalized = append(normalized, "."+strings.TrimPrefix(ext, "."))
+		}
+	}
+	return normalized
+}
+
+// parseInterpreters returns the interpreters by extension (--interpreter): '.py=/usr/bin/python3'
+func parseInterpreters(pairs []string) (map[string]string, error) {
+	interpreters := map[string]string{}
+	for _, pair := range pairs {
+		ext, interpreter, ok := strings.Cut(pair, "=")
+		ext, interpreter = strings.TrimSpace(ext), strings.TrimSpace(interpreter)
+		if !ok || ext == "" || interpreter == "" {
+			return nil, fmt.Errorf("invalid --interpreter: %q (expected .ext=/path/to/interpreter)", pair)
+		}
+		interpreters["."+strings.TrimPrefix(ext, ".")] = interpreter
+	}
+	return interpreters, nil
+}
+
+// applyInterpreters sets the interpreter of the scripts by their extension, unless the header of the script
+// sets one or the script starts with a shebang
+func applyInterpreters(scripts []Script, interpreters map[string]string) {
+	for i := range scripts {
+		script := &scripts[i]
+		if script.Command != "" || len(script.Opts["interpreter"]) > 0 || shebang(script.Content) != "" {
+			continue
+		}
+		ext := path.Ext(strings.TrimSuffix(filepath.ToSlash(script.Path), resolver.TemplateExtension))
+		if interpreter, ok := interpreters[ext]; ok {
+			script.setOpt("interpreter", interpreter)
+		}
+	}
+}
+
+// shebang returns the interpreter line of the content ('#!/usr/bin/env python3' -> '/usr/bin/env python3')
+func shebang(content []byte) string {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	rest, ok := bytes.CutPrefix(line, []byte("#!"))
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(string(rest))
+}
+
+// scriptInterpreter returns the program that runs the script on the host: the program of the interpreter opt,
+// or of the shebang; empty when the script runs with the shell
+func scriptInterpreter(task *HostTask, script Script) string {
+	if opts := scriptOpts(task, script); len(opts["interpreter"]) > 0 {
+		return interpreterProgram(opts["interpreter"][len(opts["interpreter"])-1])
+	}
+	return interpreterProgram(shebang(script.Content))
+}
+
+// interpreterProgram returns the program of an interpreter command line, the program run by env
+// ('/usr/bin/env python3 -u' -> 'python3')
+func interpreterProgram(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+	if path.Base(fields[0]) != "env" {
+		return fields[0]
+	}
+	for _, arg := range fields[1:] {
+		// env options (e.g. -S) and variables
+		if !strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") {
+			return arg
+		}
+	}
+	return ""
+}
+
+// checkInterpreter returns an error when the program is not found on the host (as the login user)
+func checkInterpreter(ctx context.Context, client sshClient, program string) error {
+	if _, err := client.RunCommand(ctx, "command -v "+rconf.ShellQuote(program)); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("interpreter %s not found on the host", program)
+	}
+	return nil
+}
+
+// interpreterChecks checks the interpreters of a host once.
+type interpreterChecks map[string]error
+
+func (c interpreterChecks) check(ctx context.Context, client sshClient, program string) error {
+	if err, ok := c[program]; ok {
+		return err
+	}
+	err := checkInterpreter(ctx, client, program)
+	if ctx.Err() == nil {
+		c[program] = err
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashmap-kz/rconf/internal/resolver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExtensions(t *testing.T) {
+	assert.Equal(t, resolver.FileExtensions, parseExtensions(nil))
+	assert.Equal(t, []string{".sh", ".py"}, parseExtensions([]string{".sh", " py", ""}))
+}
+
+func TestParseInterpreters(t *testing.T) {
+	got, err := parseInterpreters([]string{".py=/usr/bin/python3", "rb = ruby", ".py=python3.12"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{".py": "python3.12", ".rb": "ruby"}, got)
+
+	for _, pair := range []string{".py", "=/usr/bin/python3", ".py="} {
+		_, err := parseInterpreters([]string{pair})
+		assert.ErrorContains(t, err, "invalid --interpreter", pair)
+	}
+}
+
+func TestApplyInterpreters(t *testing.T) {
+	scripts := []Script{
+		{Path: "00-setup.sh", Content: []byte("echo ok\n")},
+		{Path: "01-app.py", Content: []byte("print('ok')\n")},
+		{Path: "02-motd.py.tmpl", Content: []byte("print('{{ .Host }}')\n")},
+		{Path: "03-shebang.py", Content: []byte("#!/usr/bin/env python3\nprint('ok')\n")},
+		{Path: "04-header.py", Content: []byte("print('ok')\n"), Opts: map[string][]string{"interpreter": {"python2"}}},
+		{Path: "hostname", Content: []byte("hostname"), Command: "hostname"},
+	}
+	applyInterpreters(scripts, map[string]string{".py": "/usr/bin/python3"})
+
+	assert.Nil(t, scripts[0].Opts)
+	assert.Equal(t, map[string][]string{"interpreter": {"/usr/bin/python3"}}, scripts[1].Opts)
+	assert.Equal(t, map[string][]string{"interpreter": {"/usr/bin/python3"}}, scripts[2].Opts)
+	assert.Nil(t, scripts[3].Opts)
+	assert.Equal(t, map[string][]string{"interpreter": {"python2"}}, scripts[4].Opts)
+	assert.Nil(t, scripts[5].Opts)
+}
+
+func TestScriptInterpreter(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostOpts map[string][]string
+		script   Script
+		want     string
+	}{
+		{"No shebang", nil, Script{Content: []byte("echo ok\n")}, ""},
+		{"Shebang", nil, Script{Content: []byte("#!/bin/bash -e\necho ok\n")}, "/bin/bash"},
+		{"Env", nil, Script{Content: []byte("#! /usr/bin/env python3\n")}, "python3"},
+		{"Env with options", nil, Script{Content: []byte("#!/usr/bin/env -S LANG=C python3 -u\n")}, "python3"},
+		{"Script interpreter", nil, Script{Content: []byte("#!/bin/sh\n"), Opts: map[string][]string{"interpreter": {"/usr/bin/python3 -u"}}}, "/usr/bin/python3"},
+		{"Host interpreter", map[string][]string{"interpreter": {"bash"}}, Script{Opts: map[string][]string{"interpreter": {"python3"}}}, "bash"},
+		{"Env interpreter", map[string][]string{"interpreter": {"/usr/bin/env python3"}}, Script{}, "python3"},
+		{"Env script interpreter", nil, Script{Opts: map[string][]string{"interpreter": {"/usr/bin/env -S LANG=C python3 -u"}}}, "python3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, scriptInterpreter(&HostTask{Opts: tt.hostOpts}, tt.script))
+		})
+	}
+}
+
+func TestProcessHostInterpreterCheck(t *testing.T) {
+	client := &fakeClient{failures: map[string]error{"command -v 'python3'": errors.New("exit status 1")}}
+	useFakeClient(t, client)
+
+	result := runTestTask(context.Background(), &HostTask{
+		ContinueOnError: true,
+		Scripts: []Script{
+			{Path: "00-app.py", Content: []byte("#!/usr/bin/env python3\n")},
+			{Path: "01-setup.sh", Content: []byte("#!/bin/bash\n")},
+			{Path: "02-app.py", Content: []byte("#!/usr/bin/env python3\n")},
+		},
+	})
+
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, []string{"00-app.py", "02-app.py"}, result.failedScripts())
+	assert.Equal(t, "interpreter python3 not found on the host", result.Scripts[0].Error)
+	assert.Equal(t, StatusSuccess, result.Scripts[1].Status)
+	// checked once per host, nothing uploaded for the scripts that cannot run
+	assert.Equal(t, []string{"command -v 'python3'", "command -v '/bin/bash'"}, client.commands)
+	assert.Equal(t, []string{"/tmp/01-setup.sh"}, client.executed)
+}
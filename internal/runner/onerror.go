@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Failure policies of a script: whether the remaining scripts of the host run after it failed.
+const (
+	OnErrorStop     = "stop"
+	OnErrorContinue = "continue"
+)
+
+// applyOnError sets the failure policy of the scripts from the rules PATTERN=stop|continue (--on-error).
+// A pattern matches the script path or its base name (path.Match syntax), later rules win.
+func applyOnError(scripts []Script, rules []string) error {
+	for _, rule := range rules {
+		pattern, policy, ok := strings.Cut(rule, "=")
+		pattern, policy = strings.TrimSpace(pattern), strings.TrimSpace(policy)
+		if !ok || pattern == "" {
+			return fmt.Errorf("invalid --on-error: %q (expected PATTERN=stop|continue)", rule)
+		}
+		if policy != OnErrorStop && policy != OnErrorContinue {
+			return fmt.Errorf("invalid --on-error: %q (policy must be %s or %s)", rule, OnErrorStop, OnErrorContinue)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --on-error: %q: %w", rule, err)
+		}
+		for i := range scripts {
+			name := filepath.ToSlash(scripts[i].Path)
+			if matched, _ := path.Match(pattern, name); matched {
+				scripts[i].OnError = policy
+			} else if matched, _ := path.Match(pattern, path.Base(name)); matched {
+				scripts[i].OnError = policy
+			}
+		}
+	}
+	return nil
+}
+
+// stopAfter returns the name of the failed script when the remaining scripts of the host must not run,
+// or an empty string
+func (task *HostTask) stopAfter(script Script) string {
+	continueOnError := task.ContinueOnError
+	switch script.OnError {
+	case OnErrorStop:
+		continueOnError = false
+	case OnErrorContinue:
+		continueOnError = true
+	}
+	if continueOnError {
+		return ""
+	}
+	return filepath.ToSlash(script.Path)
+}
@@ -0,0 +1,22 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyOnError(t *testing.T) {
+	scripts := []Script{{Path: "scripts/01-packages.sh"}, {Path: "scripts/02-config.sh"}, {Path: "checks/01-disk.sh"}}
+
+	err := applyOnError(scripts, []string{"checks/*=continue", "01-*.sh=stop", "checks/01-disk.sh=continue"})
+	require.NoError(t, err)
+	assert.Equal(t, OnErrorStop, scripts[0].OnError)
+	assert.Empty(t, scripts[1].OnError)
+	assert.Equal(t, OnErrorContinue, scripts[2].OnError)
+
+	for _, rule := range []string{"01-packages.sh", "=stop", "01-packages.sh=ignore", "[=stop"} {
+		assert.Error(t, applyOnError(scripts, []string{rule}), rule)
+	}
+}
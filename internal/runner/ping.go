@@ -0,0 +1,242 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/cmd"
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+)
+
+// pingHost checks a host (replaced in tests).
+var pingHost = rconf.Ping
+
+// PingResult holds the checks of a host.
+type PingResult struct {
+	Host      string // host:port
+	Status    Status // Success, Failed (no SFTP, or no sudo while the scripts use it), Connection Failed, Timeout, Canceled
+	NeedsSudo bool   // the scripts of the host run with sudo (the default become method)
+	Checks    *rconf.PingResult
+}
+
+// PingError is returned by Ping when some hosts failed the checks.
+type PingError struct {
+	Total      int
+	Failed     int
+	ConnFailed int
+	Canceled   int
+}
+
+func (e *PingError) Error() string {
+	return fmt.Sprintf("checks failed on %d of %d hosts (connection failed: %d, canceled: %d)",
+		e.Failed+e.ConnFailed+e.Canceled, e.Total, e.ConnFailed, e.Canceled)
+}
+
+// ExitCode maps the failure to the process exit code, like a run.
+func (e *PingError) ExitCode() int {
+	return (&RunError{Failed: e.Failed, ConnFailed: e.ConnFailed, Canceled: e.Canceled}).ExitCode()
+}
+
+// Ping checks in parallel that every host is reachable and accepts the credentials,
+// and that it provides what the scripts need: SFTP, and sudo (unless sudo=false), passwordless unless
+// a become password is given.
+// Nothing is uploaded or executed besides the checks.
+func Ping(ctx context.Context, cfg *cmd.Config) ([]*PingResult, error) {
+	checkConfigDefaults(cfg)
+	if err := initLogger(cfg.LogFile); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	sshCfg, err := loadSSHConfig(cfg.SSHConfigPath)
+	if err != nil {
+		slogger.Error("Failed to read ssh config", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	hosts, err := resolveHosts(cfg, sshCfg)
+	if err != nil {
+		slogger.Error("Failed to read conn-info", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+
+	becomePass, err := loadBecomePass(cfg)
+	if err != nil {
+		slogger.Error("Failed to read become password", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+
+	results := make([]*PingResult, 0, len(hosts))
+	timeouts := make([]time.Duration, 0, len(hosts))
+	for _, h := range hosts {
+		if err := rconf.ValidateOpts(h.ConnInfo.Opts); err != nil {
+			slogger.Error("Invalid conn-info", slog.String("host", h.ConnInfo.Host), slog.Any("error", err))
+			return nil, &ConfigError{Err: err}
+		}
+		// sudo is checked with the password of the host, like the scripts run
+		h.ConnInfo.Opts, err = withBecomePass(h.ConnInfo.Opts, becomePass)
+		if err != nil {
+			slogger.Error("Invalid conn-info", slog.String("host", h.ConnInfo.Host), slog.Any("error", err))
+			return nil, &ConfigError{Err: err}
+		}
+		timeout, err := durationOpt(h.ConnInfo.Opts, "host_timeout", cfg.HostTimeout)
+		if err != nil {
+			slogger.Error("Invalid conn-info", slog.String("host", h.ConnInfo.Host), slog.Any("error", err))
+			return nil, &ConfigError{Err: err}
+		}
+		timeouts = append(timeouts, timeout)
+		results = append(results, &PingResult{
+			Host:      net.JoinHostPort(h.ConnInfo.Host, h.ConnInfo.Port),
+			NeedsSudo: rconf.BecomeMethod(withBecome(h.ConnInfo.Opts, cfg.Become, "")) == rconf.BecomeSudo,
+		})
+	}
+
+	fmt.Println("\n📡 Checking hosts...")
+
+	sshOptions := newSSHOptions(cfg)
+	sem := make(chan struct{}, cfg.WorkerLimit)
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i].Checks = &rconf.PingResult{Err: context.Cause(ctx)}
+				results[i].Status = stopStatus(ctx)
+				return
+			}
+			defer func() { <-sem }()
+			checkPingHost(ctx, results[i], h.ConnInfo, sshOptions, timeouts[i])
+		}()
+	}
+	wg.Wait()
+
+	printPingSummary(os.Stdout, results)
+	return results, pingError(results)
+}
+
+// checkPingHost runs the checks of a host within its timeout, and sets the status
+func checkPingHost(ctx context.Context, result *PingResult, connInfo *connstr.ConnInfo, opts *rconf.Options, timeout time.Duration) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("host timeout (%s) exceeded", timeout))
+		defer cancel()
+	}
+
+	checks := pingHost(ctx, *connInfo, opts)
+	result.Checks = checks
+	switch {
+	case checks.Err != nil && ctx.Err() != nil:
+		result.Status = stopStatus(ctx)
+		checks.Err = context.Cause(ctx)
+	case checks.Err != nil:
+		result.Status = StatusConnFailed
+	case !checks.SFTP, result.NeedsSudo && !checks.Sudo:
+		result.Status = StatusFailed
+	default:
+		result.Status = StatusSuccess
+	}
+
+	if checks.Err != nil {
+		slogger.Error("Ping failed", slog.String("host", result.Host), slog.Any("error", checks.Err))
+		fmt.Printf("[HOST: %s] %s Checks failed\n", result.Host, pingIcon(result.Status))
+		return
+	}
+	slogger.Info("Ping succeeded",
+		slog.String("host", result.Host),
+		slog.String("auth", checks.Auth),
+		slog.Bool("sftp", checks.SFTP),
+		slog.Bool("sudo", checks.Sudo),
+		slog.Duration("latency", checks.Latency),
+		slog.String("os", checks.OS),
+	)
+	fmt.Printf("[HOST: %s] ✅ Connected (%s)\n", result.Host, checks.Auth)
+}
+
+// pingError returns a *PingError when a host failed the checks
+func pingError(results []*PingResult) error {
+	pingErr := &PingError{Total: len(results)}
+	for _, r := range results {
+		switch r.Status {
+		case StatusSuccess:
+		case StatusConnFailed:
+			pingErr.ConnFailed++
+		case StatusCanceled:
+			pingErr.Canceled++
+		default:
+			pingErr.Failed++
+		}
+	}
+	if pingErr.Failed == 0 && pingErr.ConnFailed == 0 && pingErr.Canceled == 0 {
+		return nil
+	}
+	return pingErr
+}
+
+// printPingSummary prints the checks of every host in a table, then the errors.
+func printPingSummary(w io.Writer, results []*PingResult) {
+	fmt.Fprintln(w, "\n=== Ping Summary ===")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tRESULT\tTCP\tHOST KEY\tAUTH\tSFTP\tSUDO\tLATENCY\tOS")
+	for _, r := range results {
+		c := r.Checks
+		status := "✅ OK"
+		switch r.Status {
+		case StatusFailed:
+			status = "❌ Failed"
+		case StatusConnFailed:
+			status = "❌ SSH Failed"
+		case StatusTimeout:
+			status = "⏱️ Timeout"
+		case StatusCanceled:
+			status = "🛑 Canceled"
+		}
+		if c.Err != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t-\t-\t-\t-\t-\n", r.Host, status, yesNo(c.Reachable), orDash(c.HostKey))
+			continue
+		}
+		sudo := yesNo(c.Sudo)
+		if !c.Sudo && !r.NeedsSudo {
+			sudo = "no (sudo=false)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Host, status, yesNo(c.Reachable), c.HostKey, c.Auth,
+			yesNo(c.SFTP), sudo, c.Latency.Round(time.Millisecond/10), orDash(c.OS))
+	}
+	tw.Flush()
+
+	for _, r := range results {
+		if r.Checks.Err != nil {
+			fmt.Fprintf(w, "❌ %s: %s\n", r.Host, r.Checks.Err)
+		}
+	}
+}
+
+func pingIcon(status Status) string {
+	if status == StatusTimeout || status == StatusCanceled {
+		return stopIcon(status)
+	}
+	return "❌"
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
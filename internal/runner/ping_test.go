@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/cmd"
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPing(t *testing.T) {
+	checks := map[string]*rconf.PingResult{
+		"10.0.0.1": {Reachable: true, HostKey: "known", Auth: "publickey", SFTP: true, Sudo: true, OS: "Debian GNU/Linux 12"},
+		"10.0.0.2": {Reachable: true, HostKey: "known", Auth: "password", SFTP: true},
+		"10.0.0.3": {Reachable: true, HostKey: "known", Auth: "password", SFTP: true},
+		"10.0.0.4": {Reachable: true, HostKey: "rejected", Err: errors.New("host key mismatch")},
+		"10.0.0.5": {Reachable: true, HostKey: "known", Auth: "publickey", Sudo: true},
+	}
+	prev := pingHost
+	pingHost = func(_ context.Context, connInfo connstr.ConnInfo, _ *rconf.Options) *rconf.PingResult {
+		return checks[connInfo.Host]
+	}
+	t.Cleanup(func() { pingHost = prev })
+
+	cfg := &cmd.Config{
+		ConnStrings:   []string{"root@10.0.0.[1:2]", "root@10.0.0.3?sudo=false", "root@10.0.0.[4:5]"},
+		SSHConfigPath: "none",
+		LogFile:       filepath.Join(t.TempDir(), "rconf.log"),
+	}
+	results, err := Ping(context.Background(), cfg)
+
+	require.Len(t, results, 5)
+	var statuses []Status
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+	// no sudo fails the host unless it runs without sudo, no SFTP always fails it
+	assert.Equal(t, []Status{StatusSuccess, StatusFailed, StatusSuccess, StatusConnFailed, StatusFailed}, statuses)
+	assert.Equal(t, &PingError{Total: 5, Failed: 2, ConnFailed: 1}, err)
+	assert.Equal(t, ExitConnectionFailure, ExitCode(err))
+
+	var out bytes.Buffer
+	printPingSummary(&out, results)
+	assert.Contains(t, out.String(), "no (sudo=false)")
+	assert.Contains(t, out.String(), "Debian GNU/Linux 12")
+	assert.Contains(t, out.String(), "❌ 10.0.0.4:22: host key mismatch")
+}
+
+func TestPingBecomePass(t *testing.T) {
+	passFile := filepath.Join(t.TempDir(), "pass")
+	require.NoError(t, os.WriteFile(passFile, []byte("from-file\n"), 0o600))
+	t.Setenv(becomePassEnv, "from-env")
+
+	passwords := map[string]string{}
+	var mu sync.Mutex
+	prev := pingHost
+	pingHost = func(_ context.Context, connInfo connstr.ConnInfo, _ *rconf.Options) *rconf.PingResult {
+		mu.Lock()
+		defer mu.Unlock()
+		passwords[connInfo.Host] = connInfo.Opts[rconf.BecomePassOpt][0]
+		// sudo accepts the password
+		return &rconf.PingResult{Reachable: true, HostKey: "known", Auth: "publickey", SFTP: true, Sudo: true}
+	}
+	t.Cleanup(func() { pingHost = prev })
+
+	cfg := &cmd.Config{
+		ConnStrings:   []string{"root@10.0.0.1", "root@10.0.0.2?become_pass_file=" + passFile},
+		SSHConfigPath: "none",
+		LogFile:       filepath.Join(t.TempDir(), "rconf.log"),
+	}
+	results, err := Ping(context.Background(), cfg)
+
+	require.NoError(t, err)
+	assert.Equal(t, StatusSuccess, results[0].Status)
+	assert.Equal(t, map[string]string{"10.0.0.1": "from-env", "10.0.0.2": "from-file"}, passwords)
+}
+
+func TestPingTimeout(t *testing.T) {
+	prev := pingHost
+	pingHost = func(ctx context.Context, _ connstr.ConnInfo, _ *rconf.Options) *rconf.PingResult {
+		<-ctx.Done()
+		return &rconf.PingResult{Err: ctx.Err()}
+	}
+	t.Cleanup(func() { pingHost = prev })
+
+	cfg := &cmd.Config{
+		ConnStrings:   []string{"root@10.0.0.1"},
+		SSHConfigPath: "none",
+		LogFile:       filepath.Join(t.TempDir(), "rconf.log"),
+		HostTimeout:   20 * time.Millisecond,
+	}
+	results, err := Ping(context.Background(), cfg)
+
+	require.Len(t, results, 1)
+	assert.Equal(t, StatusTimeout, results[0].Status)
+	assert.EqualError(t, results[0].Checks.Err, "host timeout (20ms) exceeded")
+	assert.Equal(t, ExitPartialFailure, ExitCode(err))
+}
@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/resolver"
+)
+
+// newRunID returns a unique ID of the run: its start time and random bytes
+func newRunID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// remoteRunDir returns the private directory of the run on the hosts, under base (--remote-dir)
+func remoteRunDir(base, runID string) string {
+	return path.Join(base, "rconf-"+runID)
+}
+
+// remoteScriptPath returns the upload path of the script in the run directory (templates lose their extension)
+func remoteScriptPath(dir string, script Script) string {
+	return path.Join(dir, remoteRelPath(script))
+}
+
+// remoteRelPath returns the path of the script relative to the run directory: the local path
+// (absolute paths lose the leading slash, '..' becomes '_parent'), or the host and path of a URL
+func remoteRelPath(script Script) string {
+	name := filepath.ToSlash(script.Path)
+	if resolver.IsURL(name) {
+		if u, err := url.Parse(name); err == nil {
+			name = path.Join(u.Host, u.Path)
+		}
+	}
+	parts := strings.Split(strings.TrimPrefix(path.Clean(name), "/"), "/")
+	for i, part := range parts {
+		if part == ".." {
+			parts[i] = "_parent"
+		}
+	}
+	parts[len(parts)-1] = strings.TrimSuffix(parts[len(parts)-1], resolver.TemplateExtension)
+	return path.Join(parts...)
+}
+
+// checkRemotePaths returns an error when two scripts would be uploaded to the same path
+func checkRemotePaths(scripts []Script) error {
+	seen := map[string]string{}
+	for _, script := range scripts {
+		if script.Command != "" {
+			continue
+		}
+		rel := remoteRelPath(script)
+		if other, ok := seen[rel]; ok {
+			return fmt.Errorf("scripts %s and %s have the same remote path %s", other, filepath.ToSlash(script.Path), rel)
+		}
+		seen[rel] = filepath.ToSlash(script.Path)
+	}
+	return nil
+}
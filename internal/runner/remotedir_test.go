@@ -0,0 +1,111 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteScriptPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"00-plain.sh", "/tmp/rconf-1/00-plain.sh"},
+		{"./scripts/db/01-init.sh", "/tmp/rconf-1/scripts/db/01-init.sh"},
+		{"/opt/scripts/02-motd.sh.tmpl", "/tmp/rconf-1/opt/scripts/02-motd.sh"},
+		{"../shared/03-users.sh", "/tmp/rconf-1/_parent/shared/03-users.sh"},
+		{"https://example.com/scripts/04-sysctl.sh", "/tmp/rconf-1/example.com/scripts/04-sysctl.sh"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, remoteScriptPath(remoteRunDir("/tmp", "1"), Script{Path: tt.path}), tt.path)
+	}
+}
+
+func TestCheckRemotePaths(t *testing.T) {
+	assert.NoError(t, checkRemotePaths([]Script{{Path: "a/01.sh"}, {Path: "b/01.sh"}}))
+	assert.EqualError(t, checkRemotePaths([]Script{{Path: "a/01.sh.tmpl"}, {Path: "a/01.sh"}}),
+		"scripts a/01.sh.tmpl and a/01.sh have the same remote path a/01.sh")
+}
+
+func TestNewRunID(t *testing.T) {
+	id := newRunID()
+	assert.Regexp(t, regexp.MustCompile(`^\d{8}T\d{6}-[0-9a-f]{8}$`), id)
+	assert.NotEqual(t, id, newRunID())
+}
+
+func TestProcessHostRemoteDir(t *testing.T) {
+	tests := []struct {
+		name       string
+		task       *HostTask
+		wantDirs   []string
+		wantUpload []string
+	}{
+		{
+			name:       "removed",
+			task:       &HostTask{Scripts: []Script{{Path: "db/00-ok.sh"}}, RemoteDir: "/tmp/rconf-1"},
+			wantDirs:   []string{"/tmp/rconf-1", "-/tmp/rconf-1"},
+			wantUpload: []string{"/tmp/rconf-1/db/00-ok.sh"},
+		},
+		{
+			name:       "kept",
+			task:       &HostTask{Scripts: []Script{{Path: "db/00-ok.sh"}}, RemoteDir: "/tmp/rconf-1", KeepRemote: true},
+			wantDirs:   []string{"/tmp/rconf-1"},
+			wantUpload: []string{"/tmp/rconf-1/db/00-ok.sh"},
+		},
+		{
+			name: "ad-hoc command",
+			task: &HostTask{Scripts: []Script{{Path: "uptime", Command: "uptime"}}, RemoteDir: "/tmp/rconf-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{}
+			useFakeClient(t, client)
+
+			result := runTestTask(context.Background(), tt.task)
+
+			assert.Equal(t, StatusSuccess, result.Status)
+			assert.Equal(t, tt.wantDirs, client.dirs)
+			assert.Equal(t, tt.wantUpload, client.uploaded)
+		})
+	}
+}
+
+// dirFailClient cannot create the remote directory
+type dirFailClient struct {
+	fakeClient
+}
+
+func (f *dirFailClient) CreateDir(string, os.FileMode) error {
+	return errors.New("permission denied")
+}
+
+func TestProcessHostRemoteDirFailed(t *testing.T) {
+	client := &dirFailClient{}
+	useFakeClient(t, client)
+
+	result := runTestHost([]Script{{Path: "00-ok.sh"}, {Path: "db/01-init.sh"}})
+
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, "permission denied", result.Error)
+	assert.Empty(t, client.uploaded)
+	// the scripts that did not run are listed as skipped
+	require.Len(t, result.Scripts, 2)
+	assert.Equal(t, "db/01-init.sh", result.Scripts[1].Script)
+	for _, s := range result.Scripts {
+		assert.Equal(t, StatusSkipped, s.Status)
+		assert.Equal(t, "not run: failed to create remote directory", s.Error)
+	}
+
+	var out bytes.Buffer
+	printSummary(&out, &Result{Hosts: []*HostResult{result}})
+	assert.Contains(t, out.String(), "❌ Failed: permission denied")
+	assert.Contains(t, out.String(), "⏭️ Skipped: 00-ok.sh, db/01-init.sh")
+}
@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status is the outcome of a host or a script.
+type Status string
+
+const (
+	StatusSuccess    Status = "Success"
+	StatusFailed     Status = "Failed"
+	StatusConnFailed Status = "Connection Failed"
+	StatusSkipped    Status = "Skipped"
+	StatusTimeout    Status = "Timeout"
+	StatusCanceled   Status = "Canceled"
+)
+
+// Process exit codes
+const (
+	ExitOK                = 0
+	ExitPartialFailure    = 2   // some scripts failed
+	ExitConnectionFailure = 3   // some hosts could not be connected
+	ExitConfigError       = 4   // invalid flags, hosts or scripts: nothing was executed
+	ExitStopped           = 5   // the rollout was stopped at --confirm: some hosts were not run
+	ExitInterrupted       = 130 // the run was canceled by SIGINT or SIGTERM
+)
+
+// ScriptResult holds the outcome of a script on a host.
+type ScriptResult struct {
+	Script   string
+	Status   Status
+	ExitCode int // remote exit status, -1 when the script did not run to completion
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Stdout   string
+	Stderr   string
+	Error    string
+}
+
+// HostResult holds the outcome of a host, with its scripts in execution order.
+type HostResult struct {
+	Host     string // host:port
+	Status   Status
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Error    string
+	Scripts  []*ScriptResult
+}
+
+// Result holds the outcome of a run, with the hosts in the input order.
+type Result struct {
+	RunID    string // unique ID of the run, names the remote directory
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Hosts    []*HostResult
+	Declined int // hosts skipped because a batch was not confirmed (--confirm)
+}
+
+// RunError is returned by Run when a host or a script failed.
+type RunError struct {
+	Total      int
+	Failed     int
+	ConnFailed int
+	Canceled   int
+	Declined   int
+}
+
+func (e *RunError) Error() string {
+	if e.Canceled > 0 {
+		return fmt.Sprintf("execution canceled on %d of %d hosts (failed: %d, connection failed: %d)",
+			e.Canceled, e.Total, e.Failed, e.ConnFailed)
+	}
+	if e.Failed == 0 && e.ConnFailed == 0 {
+		return fmt.Sprintf("rollout stopped: %d of %d hosts were not run", e.Declined, e.Total)
+	}
+	return fmt.Sprintf("execution failed on %d of %d hosts (connection failed: %d)", e.Failed+e.ConnFailed, e.Total, e.ConnFailed)
+}
+
+// ExitCode maps the failure to the process exit code: a cancellation takes precedence, then connection failures,
+// then failed scripts, then a rollout stopped at --confirm.
+func (e *RunError) ExitCode() int {
+	if e.Canceled > 0 {
+		return ExitInterrupted
+	}
+	if e.ConnFailed > 0 {
+		return ExitConnectionFailure
+	}
+	if e.Failed == 0 && e.Declined > 0 {
+		return ExitStopped
+	}
+	return ExitPartialFailure
+}
+
+// ConfigError is returned by Run when the run could not start.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the process exit code of the configuration errors.
+func (e *ConfigError) ExitCode() int {
+	return ExitConfigError
+}
+
+// ExitCode maps an error returned by Run to the process exit code.
+// Errors that do not come from the execution (e.g. invalid flags) are configuration errors.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+	return ExitConfigError
+}
+
+// Err returns a *RunError when a host or a script failed, or when the rollout was stopped at --confirm.
+func (r *Result) Err() error {
+	runErr := &RunError{Total: len(r.Hosts), Declined: r.Declined}
+	for _, h := range r.Hosts {
+		switch h.Status {
+		case StatusConnFailed:
+			runErr.ConnFailed++
+		case StatusCanceled:
+			runErr.Canceled++
+		case StatusSuccess, StatusSkipped:
+		default:
+			runErr.Failed++
+		}
+	}
+	if runErr.Failed == 0 && runErr.ConnFailed == 0 && runErr.Canceled == 0 && runErr.Declined == 0 {
+		return nil
+	}
+	return runErr
+}
+
+// finish sets the end time and the duration.
+func (r *ScriptResult) finish() {
+	r.End = time.Now()
+	r.Duration = r.End.Sub(r.Start)
+}
+
+// finish sets the end time, the duration, and the status computed from the scripts:
+// the status of the first script that did not succeed (skipped scripts are ignored).
+func (h *HostResult) finish() {
+	h.End = time.Now()
+	h.Duration = h.End.Sub(h.Start)
+	if h.Status != "" {
+		return
+	}
+	h.Status = StatusSuccess
+	for _, s := range h.Scripts {
+		if s.Status != StatusSuccess && s.Status != StatusSkipped {
+			h.Status = s.Status
+			return
+		}
+	}
+}
+
+// stopped reports whether a script failed, timed out or was canceled: that script decides the host status.
+func (h *HostResult) stopped() bool {
+	for _, s := range h.Scripts {
+		if s.Status != StatusSuccess && s.Status != StatusSkipped {
+			return true
+		}
+	}
+	return false
+}
+
+// failedScripts returns the names of the scripts that failed or timed out.
+func (h *HostResult) failedScripts() []string {
+	var failed []string
+	for _, s := range h.Scripts {
+		if s.Status == StatusFailed || s.Status == StatusTimeout {
+			failed = append(failed, s.Script)
+		}
+	}
+	return failed
+}
+
+// skippedScripts returns the names of the scripts that were not run.
+func (h *HostResult) skippedScripts() []string {
+	var skipped []string
+	for _, s := range h.Scripts {
+		if s.Status == StatusSkipped {
+			skipped = append(skipped, s.Script)
+		}
+	}
+	return skipped
+}
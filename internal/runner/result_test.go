@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultErr(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []Status
+		wantErr  bool
+		wantCode int
+	}{
+		{"All OK", []Status{StatusSuccess, StatusSuccess}, false, ExitOK},
+		{"No hosts", nil, false, ExitOK},
+		{"Partial failure", []Status{StatusSuccess, StatusFailed}, true, ExitPartialFailure},
+		{"All failed", []Status{StatusFailed, StatusFailed}, true, ExitPartialFailure},
+		{"Connection failure", []Status{StatusSuccess, StatusConnFailed}, true, ExitConnectionFailure},
+		{"Connection failure wins", []Status{StatusFailed, StatusConnFailed}, true, ExitConnectionFailure},
+		{"Timeout", []Status{StatusSuccess, StatusTimeout}, true, ExitPartialFailure},
+		{"Canceled", []Status{StatusSuccess, StatusCanceled}, true, ExitInterrupted},
+		{"Canceled wins", []Status{StatusConnFailed, StatusCanceled}, true, ExitInterrupted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &Result{}
+			for i, s := range tt.statuses {
+				result.Hosts = append(result.Hosts, &HostResult{Host: fmt.Sprintf("host%d:22", i), Status: s})
+			}
+			err := result.Err()
+			if tt.wantErr {
+				var runErr *RunError
+				assert.ErrorAs(t, err, &runErr)
+				assert.Equal(t, len(tt.statuses), runErr.Total)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantCode, ExitCode(err))
+		})
+	}
+}
+
+func TestResultErrDeclined(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []Status
+		wantCode int
+	}{
+		{"Declined", []Status{StatusSuccess, StatusSkipped}, ExitStopped},
+		{"Failed wins", []Status{StatusFailed, StatusSkipped}, ExitPartialFailure},
+		{"Connection failure wins", []Status{StatusConnFailed, StatusSkipped}, ExitConnectionFailure},
+		{"Canceled wins", []Status{StatusCanceled, StatusSkipped}, ExitInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &Result{Declined: 1}
+			for i, s := range tt.statuses {
+				result.Hosts = append(result.Hosts, &HostResult{Host: fmt.Sprintf("host%d:22", i), Status: s})
+			}
+			err := result.Err()
+			var runErr *RunError
+			assert.ErrorAs(t, err, &runErr)
+			assert.Equal(t, 1, runErr.Declined)
+			assert.Equal(t, tt.wantCode, ExitCode(err))
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, ExitOK, ExitCode(nil))
+	assert.Equal(t, ExitConfigError, ExitCode(&ConfigError{Err: errors.New("bad conn string")}))
+	assert.Equal(t, ExitConfigError, ExitCode(errors.New("unknown flag: --foo")))
+	assert.Equal(t, ExitPartialFailure, ExitCode(fmt.Errorf("wrapped: %w", &RunError{Total: 2, Failed: 1})))
+}
+
+func TestHostResultFinish(t *testing.T) {
+	h := &HostResult{Scripts: []*ScriptResult{{Status: StatusSuccess}, {Status: StatusFailed}}}
+	h.finish()
+	assert.Equal(t, StatusFailed, h.Status)
+
+	h = &HostResult{Scripts: []*ScriptResult{{Status: StatusSuccess}}}
+	h.finish()
+	assert.Equal(t, StatusSuccess, h.Status)
+
+	h = &HostResult{Scripts: []*ScriptResult{{Status: StatusSuccess}, {Status: StatusTimeout}, {Status: StatusSkipped}}}
+	h.finish()
+	assert.Equal(t, StatusTimeout, h.Status)
+
+	h = &HostResult{Status: StatusConnFailed}
+	h.finish()
+	assert.Equal(t, StatusConnFailed, h.Status)
+}
+
+func TestHostStatusFromScripts(t *testing.T) {
+	tests := []struct {
+		name     string
+		scripts  []Status
+		want     Status
+		wantCode int
+	}{
+		{"Failed script, the rest skipped", []Status{StatusSuccess, StatusFailed, StatusSkipped, StatusSkipped}, StatusFailed, ExitPartialFailure},
+		{"Failed first script", []Status{StatusFailed, StatusSkipped}, StatusFailed, ExitPartialFailure},
+		{"Timed out script", []Status{StatusSkipped, StatusTimeout, StatusSkipped}, StatusTimeout, ExitPartialFailure},
+		{"Failed script, then success", []Status{StatusFailed, StatusSuccess}, StatusFailed, ExitPartialFailure},
+		{"Skipped by tags or run_once", []Status{StatusSkipped, StatusSuccess}, StatusSuccess, ExitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HostResult{Host: "web1:22"}
+			for i, s := range tt.scripts {
+				h.Scripts = append(h.Scripts, &ScriptResult{Script: fmt.Sprintf("%02d.sh", i), Status: s})
+			}
+			h.finish()
+			assert.Equal(t, tt.want, h.Status)
+			assert.Equal(t, tt.wantCode, ExitCode((&Result{Hosts: []*HostResult{h}}).Err()))
+		})
+	}
+}
@@ -1,13 +1,19 @@
 package runner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
 
 	"github.com/hashmap-kz/rconf/internal/cmd"
 	"github.com/hashmap-kz/rconf/internal/connstr"
@@ -18,75 +24,265 @@ import (
 // Structured logger
 var slogger *slog.Logger
 
+// Script is a single script of the execution plan.
+type Script struct {
+	Path     string
+	Content  []byte
+	Template *template.Template // rendered per host, nil for plain scripts
+	Command  string             // ad-hoc command (rconf exec): run as-is, nothing is uploaded
+	OnError  string             // OnErrorStop, OnErrorContinue, or empty for the host default
+
+	// settings from the '# rconf:' header lines
+	Opts    map[string][]string // sudo, interpreter: the host opts win
+	Timeout time.Duration       // --script-timeout and the host opt win
+	Retries int                 // extra attempts after a failure
+	Tags    []string
+	RunOnce bool // run on the first host only
+}
+
+// sshClient is the part of the SSH client used while processing a host.
+type sshClient interface {
+	UploadScript(scriptContent []byte, remotePath string) error
+	CreateDir(remotePath string, mode os.FileMode) error
+	RemoveDir(remotePath string) error
+	ExecuteScript(ctx context.Context, remotePath string, opts map[string][]string, stream *rconf.Stream) (*rconf.ExecResult, error)
+	ExecuteCommand(ctx context.Context, command string, opts map[string][]string, stream *rconf.Stream) (*rconf.ExecResult, error)
+	RunCommand(ctx context.Context, cmd string) (*rconf.ExecResult, error)
+	Close()
+}
+
+// newSSHClient establishes a connection to a host (replaced in tests).
+var newSSHClient = func(ctx context.Context, connInfo connstr.ConnInfo, opts *rconf.Options) (sshClient, error) {
+	client, err := rconf.NewSSHClient(ctx, connInfo, opts)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
 // HostTask encapsulates all information needed to process a host.
 type HostTask struct {
-	User                 string
-	Password             string
-	Host                 string
-	Port                 string
-	Opts                 map[string][]string
-	PrivateKeyPath       string
-	PrivateKeyPassphrase string
-	ScriptContents       map[string][]byte
-	Results              *sync.Map
+	User          string
+	Password      string
+	Host          string
+	Port          string
+	Opts          map[string][]string
+	Jumps         []*connstr.ConnInfo
+	IdentityFiles []string // from the ssh config, tried after the explicit keys
+	SSHOptions    *rconf.Options
+	Scripts       []Script
+	Result        *HostResult
 
+	ScriptTimeout   time.Duration // 0: no limit
+	HostTimeout     time.Duration // 0: no limit
+	Stream          bool          // print the remote output as it arrives
+	ContinueOnError bool          // run the remaining scripts after a failed script (unless the script says otherwise)
+	RemoteDir       string        // private directory of the run on the host, the scripts are uploaded there
+	RunID           string        // unique ID of the run, exported to the scripts
+	KeepRemote      bool          // keep the remote directory after the run
+
+	TemplateData *templateData // data of the script templates
+	GatherFacts  bool          // gather the facts used by the templates
+
+	plan      []*plannedScript // dry-run plan
+	once      *runOnce         // run_once scripts, shared by the hosts
+	failures  *failureLimit    // shared by the hosts, nil for no limit
 	wg        *sync.WaitGroup
 	semaphore chan struct{}
 }
 
 // Run executes scripts on multiple hosts with concurrency control.
-func Run(cfg *cmd.Config) error {
+//
+// When the context is canceled, no new hosts or scripts are started and the running scripts are stopped.
+// The result holds the outcome of every host and script. The error is a *ConfigError when
+// the run could not start, and a *RunError when a host or a script failed (or was canceled).
+func Run(ctx context.Context, cfg *cmd.Config) (*Result, error) {
 	checkConfigDefaults(cfg)
-	initLogger(cfg.LogFile)
+	if err := initLogger(cfg.LogFile); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
 
-	scriptContents, err := readScriptsIntoMemory(cfg.Filenames, cfg.Recursive)
+	scripts, err := readScripts(cfg)
 	if err != nil {
 		slogger.Error("Failed to read scripts", slog.Any("error", err))
-		return err
+		return nil, &ConfigError{Err: err}
 	}
-
-	fmt.Println("\n🚀 Starting script execution...")
+	if err := parseTemplates(scripts, cfg.Template); err != nil {
+		slogger.Error("Failed to parse templates", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	extraVars, err := loadExtraVars(cfg.VarsFiles, cfg.Vars)
+	if err != nil {
+		slogger.Error("Failed to read variables", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	scripts, err = filterTags(scripts, cfg.Tags, cfg.SkipTags)
+	if err != nil {
+		slogger.Error("Failed to select scripts", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	if err := applyOnError(scripts, cfg.OnError); err != nil {
+		slogger.Error("Invalid failure policy", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	if err := checkRemotePaths(scripts); err != nil {
+		slogger.Error("Invalid scripts", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	needFacts := usesFacts(scripts)
 
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, cfg.WorkerLimit)
-	results := &sync.Map{}
+	result := &Result{RunID: newRunID()}
+	remoteDir := remoteRunDir(cfg.RemoteDir, result.RunID)
+	sshOptions := newSSHOptions(cfg)
+	sshOptions.NoSFTP = cfg.Command != ""
+
+	sshCfg, err := loadSSHConfig(cfg.SSHConfigPath)
+	if err != nil {
+		slogger.Error("Failed to read ssh config", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
 
 	// prepare tasks
 
-	tasks := make([]*HostTask, 0, len(cfg.ConnStrings))
-	for _, connStr := range cfg.ConnStrings {
-		connInfo, err := connstr.ParseConnectionString(connStr)
+	hosts, err := resolveHosts(cfg, sshCfg)
+	if err != nil {
+		slogger.Error("Failed to read conn-info", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+
+	allowedFailures, err := parseMaxFail(cfg.FailFast, cfg.MaxFail, len(hosts))
+	if err != nil {
+		slogger.Error("Invalid failure limit", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	if allowedFailures < 0 && cfg.Serial != "" {
+		// a batch starts only when the previous ones succeeded
+		allowedFailures = 0
+	}
+	var failures *failureLimit
+	if allowedFailures >= 0 {
+		failures = newFailureLimit(allowedFailures)
+	}
+
+	becomePass, err := loadBecomePass(cfg)
+	if err != nil {
+		slogger.Error("Failed to read become password", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+
+	env, err := loadEnv(cfg.EnvFiles, cfg.Env)
+	if err != nil {
+		slogger.Error("Failed to read environment", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+
+	once := newRunOnce()
+	tasks := make([]*HostTask, 0, len(hosts))
+	for _, h := range hosts {
+		connInfo := h.ConnInfo
+		if err := rconf.ValidateOpts(connInfo.Opts); err != nil {
+			slogger.Error("Invalid conn-info", slog.String("host", connInfo.Host), slog.Any("error", err))
+			return nil, &ConfigError{Err: err}
+		}
+		scriptTimeout, err := durationOpt(connInfo.Opts, "script_timeout", cfg.ScriptTimeout)
+		if err != nil {
+			slogger.Error("Invalid conn-info", slog.String("host", connInfo.Host), slog.Any("error", err))
+			return nil, &ConfigError{Err: err}
+		}
+		hostTimeout, err := durationOpt(connInfo.Opts, "host_timeout", cfg.HostTimeout)
+		if err != nil {
+			slogger.Error("Invalid conn-info", slog.String("host", connInfo.Host), slog.Any("error", err))
+			return nil, &ConfigError{Err: err}
+		}
+		opts, err := withBecomePass(withBecome(withEnv(connInfo.Opts, env, cfg.Args), cfg.Become, cfg.BecomeUser), becomePass)
 		if err != nil {
-			slogger.Error("Failed to read conn-info", slog.Any("error", err))
-			return err
+			slogger.Error("Invalid conn-info", slog.String("host", connInfo.Host), slog.Any("error", err))
+			return nil, &ConfigError{Err: err}
+		}
+		if err := rconf.ValidateBecome(opts); err != nil {
+			slogger.Error("Invalid conn-info", slog.String("host", connInfo.Host), slog.Any("error", err))
+			return nil, &ConfigError{Err: err}
 		}
+		hostResult := &HostResult{Host: net.JoinHostPort(connInfo.Host, connInfo.Port)}
+		result.Hosts = append(result.Hosts, hostResult)
 		task := &HostTask{
-			User:                 connInfo.User,
-			Password:             connInfo.Password,
-			Host:                 connInfo.Host,
-			Port:                 connInfo.Port,
-			Opts:                 connInfo.Opts,
-			PrivateKeyPath:       cfg.PrivateKeyPath,
-			PrivateKeyPassphrase: cfg.PrivateKeyPassphrase,
-			ScriptContents:       scriptContents,
-			Results:              results,
-			wg:                   &wg,
-			semaphore:            sem,
+			User:          connInfo.User,
+			Password:      connInfo.Password,
+			Host:          connInfo.Host,
+			Port:          connInfo.Port,
+			Opts:          opts,
+			Jumps:         connInfo.Jumps,
+			IdentityFiles: connInfo.IdentityFiles,
+			SSHOptions:    sshOptions,
+			Scripts:       scripts,
+			Result:        hostResult,
+
+			ScriptTimeout:   scriptTimeout,
+			HostTimeout:     hostTimeout,
+			Stream:          cfg.Stream,
+			ContinueOnError: cfg.ContinueOnError,
+			RemoteDir:       remoteDir,
+			RunID:           result.RunID,
+			KeepRemote:      cfg.KeepRemote,
+
+			TemplateData: newTemplateData(h, extraVars),
+			GatherFacts:  needFacts,
+
+			wg:        &wg,
+			semaphore: sem,
+			failures:  failures,
+			once:      once,
 		}
 		tasks = append(tasks, task)
 	}
+	if err := checkBecome(tasks); err != nil {
+		slogger.Error("Invalid privilege escalation", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	if err := checkTemplates(scripts, tasks); err != nil {
+		slogger.Error("Failed to render templates", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
+	serial := cfg.Serial
+	if cfg.DryRun {
+		serial = ""
+	}
+	batches, err := newRollout(tasks, serial, cfg.Pause, cfg.Confirm, failures)
+	if err != nil {
+		slogger.Error("Invalid batches", slog.Any("error", err))
+		return nil, &ConfigError{Err: err}
+	}
 
 	// run tasks
 
-	for _, task := range tasks {
-		wg.Add(1)
-		go processHost(task)
+	if cfg.DryRun {
+		fmt.Println("\n📋 Dry run: nothing will be uploaded or executed")
+	} else {
+		fmt.Println("\n🚀 Starting script execution...")
 	}
 
-	wg.Wait()
+	if cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cfg.Deadline, fmt.Errorf("run deadline (%s) exceeded", cfg.Deadline))
+		defer cancel()
+	}
 
-	printSummary(results)
-	return nil
+	result.Start = time.Now()
+	if cfg.DryRun {
+		batches.run(ctx, &wg, func(ctx context.Context, task *HostTask) { planHost(ctx, task, cfg.DryRunConnect) })
+	} else {
+		result.Declined = batches.run(ctx, &wg, processHost)
+	}
+	if cfg.DryRun {
+		printPlans(os.Stdout, tasks, cfg.DryRunConnect)
+	}
+	result.End = time.Now()
+	result.Duration = result.End.Sub(result.Start)
+
+	printSummary(os.Stdout, result)
+	return result, result.Err()
 }
 
 // checkConfigDefaults checks and sets default values when they're empty
@@ -97,38 +293,102 @@ func checkConfigDefaults(cfg *cmd.Config) {
 	if cfg.WorkerLimit <= 0 {
 		cfg.WorkerLimit = 2
 	}
+	if cfg.HostKeyCheck == "" {
+		cfg.HostKeyCheck = rconf.HostKeyStrict
+	}
+	if cfg.DryRunConnect {
+		cfg.DryRun = true
+	}
+	if cfg.RemoteDir == "" {
+		cfg.RemoteDir = "/tmp"
+	}
+}
+
+// newSSHOptions returns the client settings shared by all hosts
+func newSSHOptions(cfg *cmd.Config) *rconf.Options {
+	return &rconf.Options{
+		PrivateKeyPath:       cfg.PrivateKeyPath,
+		PrivateKeyPassphrase: cfg.PrivateKeyPassphrase,
+		KnownHostsPath:       cfg.KnownHostsPath,
+		HostKeyCheck:         cfg.HostKeyCheck,
+		UseAgent:             cfg.UseAgent,
+		Bastions:             rconf.NewBastionPool(),
+	}
 }
 
 // initLogger initializes structured logging with slog.
-func initLogger(logFile string) {
+func initLogger(logFile string) error {
 	file, err := os.OpenFile(logFile, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
-		fmt.Println("Failed to open log file:", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	writer := io.MultiWriter(file)
 	slogger = slog.New(slog.NewTextHandler(writer, nil))
+	return nil
 }
 
 // processHost handles script execution on a single host.
-func processHost(task *HostTask) {
+//
+// The host stops when its context is done (host timeout, run deadline or cancellation): the running script
+// is interrupted and the remaining scripts are skipped.
+func processHost(ctx context.Context, task *HostTask) {
 	defer task.wg.Done()
-	task.semaphore <- struct{}{}
+
+	hostResult := task.Result
+	hostInfoLog := hostResult.Host
+
+	select {
+	case task.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		// the run ended before a worker was free
+		hostResult.Start = time.Now()
+		hostResult.Status = stopStatus(ctx)
+		hostResult.Error = context.Cause(ctx).Error()
+		hostResult.finish()
+		fmt.Printf("[HOST: %s] %s Not started: %s\n", hostInfoLog, stopIcon(hostResult.Status), hostResult.Error)
+		return
+	case <-task.failures.done():
+		skipHost(task, task.failures.exceeded())
+		return
+	}
 	defer func() { <-task.semaphore }()
+	if reason := task.failures.exceeded(); reason != "" {
+		skipHost(task, reason)
+		return
+	}
+
+	hostResult.Start = time.Now()
+	defer func() { task.failures.record(hostResult.Status) }()
+	defer hostResult.finish()
 
-	hostInfoLog := fmt.Sprintf("%s:%s", task.Host, task.Port)
+	if task.HostTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, task.HostTimeout, fmt.Errorf("host timeout (%s) exceeded", task.HostTimeout))
+		defer cancel()
+	}
 
 	fmt.Printf("[HOST: %s] 🔄 Connecting...\n", hostInfoLog)
-	client, err := rconf.NewSSHClient(connstr.ConnInfo{
+	client, err := newSSHClient(ctx, connstr.ConnInfo{
 		User:     task.User,
 		Password: task.Password,
 		Host:     task.Host,
 		Port:     task.Port,
-	}, task.PrivateKeyPath, task.PrivateKeyPassphrase)
+		Opts:     task.Opts,
+		Jumps:    task.Jumps,
+
+		IdentityFiles: task.IdentityFiles,
+	}, task.SSHOptions)
 	if err != nil {
 		slogger.Error("SSH connection failed", slog.String("host", hostInfoLog), slog.Any("error", err))
+		if ctx.Err() != nil {
+			hostResult.Status = stopStatus(ctx)
+			hostResult.Error = context.Cause(ctx).Error()
+			fmt.Printf("[HOST: %s] %s SSH connection stopped: %s\n", hostInfoLog, stopIcon(hostResult.Status), hostResult.Error)
+			return
+		}
 		fmt.Printf("[HOST: %s] ❌ SSH connection failed\n", hostInfoLog)
-		task.Results.Store(hostInfoLog, "SSH Failed")
+		hostResult.Status = StatusConnFailed
+		hostResult.Error = err.Error()
 		return
 	}
 	defer func() {
@@ -136,64 +396,333 @@ func processHost(task *HostTask) {
 		client.Close()
 	}()
 
-	failedScripts := []string{}
-
-	for script, content := range task.ScriptContents {
-		remotePath := fmt.Sprintf("/tmp/%s", filepath.Base(script))
-		fmt.Printf("[HOST: %s] ⏳ Uploading %s...\n", hostInfoLog, filepath.ToSlash(script))
+	// ad-hoc commands upload nothing
+	if len(task.Scripts) > 0 && task.Scripts[0].Command == "" {
+		if err := client.CreateDir(task.RemoteDir, remoteDirMode(task)); err != nil {
+			slogger.Error("Failed to create remote directory", slog.String("host", hostInfoLog), slog.Any("error", err))
+			fmt.Printf("[HOST: %s] ❌ Failed to create remote directory %s\n", hostInfoLog, task.RemoteDir)
+			hostResult.Status = StatusFailed
+			hostResult.Error = err.Error()
+			hostResult.skipScripts(task.Scripts, "not run: failed to create remote directory")
+			return
+		}
+		defer removeRemoteDir(client, task)
+	}
 
-		err := client.UploadScript(content, remotePath)
+	data := task.TemplateData
+	if task.GatherFacts {
+		facts, err := gatherFacts(ctx, client)
 		if err != nil {
-			slogger.Error("Failed to upload script",
+			slogger.Error("Failed to gather facts", slog.String("host", hostInfoLog), slog.Any("error", err))
+			fmt.Printf("[HOST: %s] ❌ Failed to gather facts\n", hostInfoLog)
+			hostResult.Status = StatusFailed
+			hostResult.Error = fmt.Sprintf("failed to gather facts: %s", err)
+			hostResult.skipScripts(task.Scripts, "not run: "+hostResult.Error)
+			return
+		}
+		withFacts := *data
+		withFacts.Facts = facts
+		data = &withFacts
+	}
+
+	failedScript := "" // the failed script that stops the host
+	interpreters := interpreterChecks{}
+	for _, script := range task.Scripts {
+		scriptResult := &ScriptResult{Script: filepath.ToSlash(script.Path), ExitCode: -1, Start: time.Now()}
+		hostResult.Scripts = append(hostResult.Scripts, scriptResult)
+
+		if ctx.Err() != nil {
+			scriptResult.Status = StatusSkipped
+			scriptResult.Error = context.Cause(ctx).Error()
+			scriptResult.finish()
+			if hostResult.Status == "" && !hostResult.stopped() {
+				// nothing failed before: the host stopped, it did not succeed
+				hostResult.Status = stopStatus(ctx)
+				hostResult.Error = scriptResult.Error
+			}
+			continue
+		}
+		if failedScript != "" {
+			scriptResult.Status = StatusSkipped
+			scriptResult.Error = fmt.Sprintf("not run: %s failed", failedScript)
+			scriptResult.finish()
+			fmt.Printf("[HOST: %s] ⏭️ Skipped %s: %s\n", hostInfoLog, filepath.ToSlash(script.Path), scriptResult.Error)
+			continue
+		}
+
+		if script.RunOnce {
+			if owner, ok := task.once.claim(scriptResult.Script, hostResult.Host); !ok {
+				scriptResult.Status = StatusSkipped
+				scriptResult.Error = fmt.Sprintf("run_once: runs on %s", owner)
+				scriptResult.finish()
+				fmt.Printf("[HOST: %s] ⏭️ Skipped %s: %s\n", hostInfoLog, scriptResult.Script, scriptResult.Error)
+				continue
+			}
+		}
+
+		// ad-hoc commands run as-is, scripts are rendered and uploaded
+		remotePath := ""
+		if script.Command == "" {
+			if program := scriptInterpreter(task, script); program != "" {
+				if err := interpreters.check(ctx, client, program); err != nil {
+					slogger.Error("Interpreter check failed",
+						slog.String("host", hostInfoLog),
+						slog.String("script", script.Path),
+						slog.Any("error", err),
+					)
+					fmt.Printf("[HOST: %s] ❌ %s: %s\n", hostInfoLog, filepath.ToSlash(script.Path), err)
+					scriptResult.Status = StatusFailed
+					scriptResult.Error = err.Error()
+					scriptResult.finish()
+					failedScript = task.stopAfter(script)
+					continue
+				}
+			}
+
+			content, err := renderScript(script, data)
+			if err != nil {
+				slogger.Error("Failed to render script",
+					slog.String("host", hostInfoLog),
+					slog.String("script", script.Path),
+					slog.Any("error", err),
+				)
+				fmt.Printf("[HOST: %s] ❌ Render failed for %s\n", hostInfoLog, filepath.ToSlash(script.Path))
+				scriptResult.Status = StatusFailed
+				scriptResult.Error = err.Error()
+				scriptResult.finish()
+				failedScript = task.stopAfter(script)
+				continue
+			}
+
+			remotePath = remoteScriptPath(task.RemoteDir, script)
+			fmt.Printf("[HOST: %s] ⏳ Uploading %s...\n", hostInfoLog, filepath.ToSlash(script.Path))
+
+			err = client.UploadScript(content, remotePath)
+			if err != nil {
+				slogger.Error("Failed to upload script",
+					slog.String("host", hostInfoLog),
+					slog.String("script", script.Path),
+					slog.Any("error", err),
+				)
+				fmt.Printf("[HOST: %s] ❌ Upload failed for %s\n", hostInfoLog, filepath.ToSlash(script.Path))
+				scriptResult.Status = StatusFailed
+				scriptResult.Error = err.Error()
+				scriptResult.finish()
+				failedScript = task.stopAfter(script)
+				continue
+			}
+		}
+
+		fmt.Printf("[HOST: %s] 🚀 Executing %s...\n", hostInfoLog, filepath.ToSlash(script.Path))
+		output, err := executeScript(ctx, client, script, remotePath, task)
+		for attempt := 1; err != nil && attempt <= script.Retries && ctx.Err() == nil; attempt++ {
+			slogger.Warn("Execution failed, retrying",
 				slog.String("host", hostInfoLog),
-				slog.String("script", script),
+				slog.String("script", filepath.ToSlash(script.Path)),
+				slog.Int("attempt", attempt),
 				slog.Any("error", err),
 			)
-			fmt.Printf("[HOST: %s] ❌ Upload failed for %s\n", hostInfoLog, filepath.ToSlash(script))
-			failedScripts = append(failedScripts, script)
-			continue
+			fmt.Printf("[HOST: %s] 🔁 Retrying %s (%d/%d)...\n", hostInfoLog, filepath.ToSlash(script.Path), attempt, script.Retries)
+			output, err = executeScript(ctx, client, script, remotePath, task)
 		}
-
-		fmt.Printf("[HOST: %s] 🚀 Executing %s...\n", hostInfoLog, filepath.ToSlash(script))
-		output, err := client.ExecuteScript(remotePath, task.Opts)
+		scriptResult.ExitCode = rconf.ExitStatus(err)
+		scriptResult.Stdout = output.Stdout
+		scriptResult.Stderr = output.Stderr
+		scriptResult.finish()
 		if err != nil {
 			slogger.Error("Execution failed",
 				slog.String("host", hostInfoLog),
-				slog.String("script", filepath.ToSlash(script)),
+				slog.String("script", filepath.ToSlash(script.Path)),
 				slog.Any("error", err),
-				slog.String("output", output),
+				slog.String("stdout", output.Stdout),
+				slog.String("stderr", output.Stderr),
 			)
-			fmt.Printf("[HOST: %s] ❌ Execution failed for %s\n", hostInfoLog, filepath.ToSlash(script))
-			failedScripts = append(failedScripts, filepath.ToSlash(script))
+			var stopErr *stopError
+			if errors.As(err, &stopErr) {
+				fmt.Printf("[HOST: %s] %s Execution stopped for %s: %s\n",
+					hostInfoLog, stopIcon(stopErr.status), filepath.ToSlash(script.Path), stopErr.Error())
+				scriptResult.Status = stopErr.status
+				scriptResult.ExitCode = -1
+				scriptResult.Error = stopErr.Error()
+				failedScript = task.stopAfter(script)
+				continue
+			}
+			fmt.Printf("[HOST: %s] ❌ Execution failed for %s\n", hostInfoLog, filepath.ToSlash(script.Path))
+			scriptResult.Status = StatusFailed
+			scriptResult.Error = err.Error()
+			failedScript = task.stopAfter(script)
 			continue
 		}
 
-		fmt.Printf("[HOST: %s] ✅ Successfully executed %s\n", hostInfoLog, filepath.ToSlash(script))
+		slogger.Info("Execution succeeded",
+			slog.String("host", hostInfoLog),
+			slog.String("script", filepath.ToSlash(script.Path)),
+			slog.String("stdout", output.Stdout),
+			slog.String("stderr", output.Stderr),
+		)
+		scriptResult.Status = StatusSuccess
+		fmt.Printf("[HOST: %s] ✅ Successfully executed %s\n", hostInfoLog, filepath.ToSlash(script.Path))
+	}
+}
+
+// removeRemoteDir removes the remote directory of the run, unless it is kept for debugging
+func removeRemoteDir(client sshClient, task *HostTask) {
+	hostInfoLog := task.Result.Host
+	if task.KeepRemote {
+		fmt.Printf("[HOST: %s] 📁 Kept remote directory %s\n", hostInfoLog, task.RemoteDir)
+		return
+	}
+	if err := client.RemoveDir(task.RemoteDir); err != nil {
+		slogger.Warn("Failed to remove remote directory",
+			slog.String("host", hostInfoLog),
+			slog.String("dir", task.RemoteDir),
+			slog.Any("error", err),
+		)
+		fmt.Printf("[HOST: %s] ⚠️ Failed to remove remote directory %s\n", hostInfoLog, task.RemoteDir)
+	}
+}
+
+// skipHost records the host and its scripts as skipped, the host was not started
+func skipHost(task *HostTask, reason string) {
+	hostResult := task.Result
+	hostResult.Start = time.Now()
+	hostResult.Status = StatusSkipped
+	hostResult.Error = reason
+	hostResult.skipScripts(task.Scripts, reason)
+	hostResult.finish()
+	fmt.Printf("[HOST: %s] ⏭️ Skipped: %s\n", hostResult.Host, reason)
+}
+
+// skipScripts records the scripts as skipped for the reason, so that the summary and the reports list them.
+func (h *HostResult) skipScripts(scripts []Script, reason string) {
+	for _, script := range scripts {
+		scriptResult := &ScriptResult{
+			Script: filepath.ToSlash(script.Path), Status: StatusSkipped, ExitCode: -1, Start: time.Now(), Error: reason,
+		}
+		scriptResult.finish()
+		h.Scripts = append(h.Scripts, scriptResult)
+	}
+}
+
+// stopError is returned by executeScript when the script was interrupted by a time limit or a cancellation.
+type stopError struct {
+	status Status // StatusTimeout or StatusCanceled
+	cause  error
+}
+
+func (e *stopError) Error() string {
+	return e.cause.Error()
+}
+
+// stopStatus returns the status of the work stopped by the context.
+func stopStatus(ctx context.Context) Status {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return StatusTimeout
 	}
+	return StatusCanceled
+}
 
-	if len(failedScripts) > 0 {
-		task.Results.Store(hostInfoLog, fmt.Sprintf("❌ Failed: %s", strings.Join(failedScripts, ", ")))
+func stopIcon(status Status) string {
+	if status == StatusTimeout {
+		return "⏱️"
+	}
+	return "🛑"
+}
+
+// executeScript runs the uploaded script (or the ad-hoc command) within the script timeout
+// (and the limits of the host context).
+func executeScript(ctx context.Context, client sshClient, script Script, remotePath string, task *HostTask) (*rconf.ExecResult, error) {
+	if timeout := scriptTimeout(task, script); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("script timeout (%s) exceeded", timeout))
+		defer cancel()
+	}
+	var stream *rconf.Stream
+	if task.Stream {
+		var flush func()
+		stream, flush = hostStream(task.Result.Host)
+		defer flush()
+	}
+	var output *rconf.ExecResult
+	var err error
+	if script.Command != "" {
+		output, err = client.ExecuteCommand(ctx, script.Command, execOpts(task, script), stream)
 	} else {
-		task.Results.Store(hostInfoLog, "✅ Success")
+		output, err = client.ExecuteScript(ctx, remotePath, execOpts(task, script), stream)
 	}
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return output, &stopError{status: stopStatus(ctx), cause: context.Cause(ctx)}
+	}
+	return output, err
 }
 
 // printSummary prints the execution results in a well-formatted table using tabwriter.
-func printSummary(results *sync.Map) {
-	fmt.Println("\n=== Execution Summary ===")
+// The scripts skipped on a host that ran are listed under the host.
+func printSummary(out io.Writer, result *Result) {
+	fmt.Fprintln(out, "\n=== Execution Summary ===")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tRESULT\tDURATION")
+	for _, h := range result.Hosts {
+		var status string
+		switch h.Status {
+		case StatusSuccess:
+			status = "✅ Success"
+		case StatusFailed:
+			status = fmt.Sprintf("❌ Failed: %s", stopSummary(h))
+		case StatusTimeout:
+			status = fmt.Sprintf("⏱️ Timeout: %s", stopSummary(h))
+		case StatusCanceled:
+			status = fmt.Sprintf("🛑 Canceled: %s", stopSummary(h))
+		case StatusConnFailed:
+			status = "❌ SSH Failed"
+		case StatusSkipped:
+			status = "⏭️ Skipped"
+			if h.Error != "" {
+				status += ": " + h.Error
+			}
+		default:
+			status = string(h.Status)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", h.Host, status, h.Duration.Round(time.Millisecond))
+		if skipped := h.skippedScripts(); len(skipped) > 0 && h.Status != StatusSkipped {
+			fmt.Fprintf(w, "\t⏭️ Skipped: %s\n", strings.Join(skipped, ", "))
+		}
+	}
+	w.Flush()
+}
+
+// stopSummary returns the scripts that were stopped, or the error when the host stopped before its scripts.
+func stopSummary(h *HostResult) string {
+	if failed := h.failedScripts(); len(failed) > 0 {
+		return strings.Join(failed, ", ")
+	}
+	return h.Error
+}
 
-	// Iterate over results and print each row
-	results.Range(func(key, value interface{}) bool {
-		fmt.Printf("%v %v\n", key, value)
-		return true
-	})
+// readScripts returns the ad-hoc command as a single script, or reads the scripts with their interpreters
+func readScripts(cfg *cmd.Config) ([]Script, error) {
+	if cfg.Command != "" {
+		return []Script{{Path: cfg.Command, Content: []byte(cfg.Command), Command: cfg.Command}}, nil
+	}
+	interpreters, err := parseInterpreters(cfg.Interpreters)
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := readScriptsIntoMemory(cfg.Filenames, cfg.Recursive, parseExtensions(cfg.Extensions))
+	if err != nil {
+		return nil, err
+	}
+	applyInterpreters(scripts, interpreters)
+	return scripts, nil
 }
 
 // readScriptsIntoMemory reads all scripts (including from directories) before execution and stores their contents.
-func readScriptsIntoMemory(scriptPaths []string, recursive bool) (map[string][]byte, error) {
-	scriptContents := make(map[string][]byte)
+// The returned plan keeps the order produced by the resolver.
+func readScriptsIntoMemory(scriptPaths []string, recursive bool, extensions []string) ([]Script, error) {
+	scripts := []Script{}
 
-	files, err := resolver.ResolveAllFiles(scriptPaths, recursive)
+	files, err := resolver.ResolveAllFiles(scriptPaths, recursive, extensions)
 	if err != nil {
 		return nil, err
 	}
@@ -203,15 +732,18 @@ func readScriptsIntoMemory(scriptPaths []string, recursive bool) (map[string][]b
 			if err != nil {
 				return nil, err
 			}
-			scriptContents[f] = data
+			scripts = append(scripts, Script{Path: f, Content: data})
 		} else {
 			data, err := os.ReadFile(f)
 			if err != nil {
 				return nil, err
 			}
-			scriptContents[f] = data
+			scripts = append(scripts, Script{Path: f, Content: data})
+		}
+		if err := parseDirectives(&scripts[len(scripts)-1]); err != nil {
+			return nil, err
 		}
 	}
 
-	return scriptContents, nil
+	return scripts, nil
 }
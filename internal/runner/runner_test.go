@@ -1,11 +1,25 @@
 package runner
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashmap-kz/rconf/internal/cmd"
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/hashmap-kz/rconf/internal/resolver"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -34,9 +48,405 @@ func TestRunner(t *testing.T) {
 			"root@localhost:12223",
 		},
 		PrivateKeyPath: sshPrivateKey,
+		HostKeyCheck:   "off",
 		WorkerLimit:    2,
 	}
 
-	err = Run(&config)
+	result, err := Run(context.Background(), &config)
 	assert.NoError(t, err)
+	assert.Len(t, result.Hosts, 2)
+}
+
+// fakeClient records the order in which scripts are uploaded and executed.
+type fakeClient struct {
+	mu       sync.Mutex
+	uploaded []string
+	executed []string
+	commands []string
+	contents map[string]string              // remote path -> uploaded content
+	failures map[string]error               // remote path (or command) -> execution error
+	delays   map[string]time.Duration       // remote path -> execution time
+	stdout   string                         // output of the commands
+	dirs     []string                       // created remote directories, "-dir" when removed
+	dirMode  os.FileMode                    // mode of the created directory
+	opts     map[string]map[string][]string // remote path -> opts of the execution
+}
+
+func (f *fakeClient) CreateDir(remotePath string, mode os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dirs = append(f.dirs, remotePath)
+	f.dirMode = mode
+	return nil
+}
+
+func (f *fakeClient) RemoveDir(remotePath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dirs = append(f.dirs, "-"+remotePath)
+	return nil
+}
+
+func (f *fakeClient) UploadScript(content []byte, remotePath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploaded = append(f.uploaded, remotePath)
+	if f.contents == nil {
+		f.contents = map[string]string{}
+	}
+	f.contents[remotePath] = string(content)
+	return nil
+}
+
+func (f *fakeClient) ExecuteScript(ctx context.Context, remotePath string, opts map[string][]string, stream *rconf.Stream) (*rconf.ExecResult, error) {
+	f.mu.Lock()
+	f.executed = append(f.executed, remotePath)
+	if f.opts == nil {
+		f.opts = map[string]map[string][]string{}
+	}
+	f.opts[remotePath] = opts
+	f.mu.Unlock()
+
+	output := &rconf.ExecResult{Stdout: "out " + remotePath, Stderr: "err " + remotePath}
+	if stream != nil {
+		_, _ = io.WriteString(stream.Stdout, output.Stdout)
+		_, _ = io.WriteString(stream.Stderr, output.Stderr)
+	}
+	select {
+	case <-time.After(f.delays[remotePath]):
+	case <-ctx.Done():
+		return output, fmt.Errorf("failed to execute script: %w", ctx.Err())
+	}
+	return output, f.failures[remotePath]
+}
+
+// ExecuteCommand records the command like an executed script
+func (f *fakeClient) ExecuteCommand(ctx context.Context, command string, opts map[string][]string, stream *rconf.Stream) (*rconf.ExecResult, error) {
+	return f.ExecuteScript(ctx, command, opts, stream)
+}
+
+func (f *fakeClient) RunCommand(_ context.Context, cmd string) (*rconf.ExecResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, cmd)
+	return &rconf.ExecResult{Stdout: f.stdout}, f.failures[cmd]
+}
+
+func (f *fakeClient) Close() {}
+
+func useFakeClient(t *testing.T, client sshClient) {
+	t.Helper()
+	prevClient, prevLogger := newSSHClient, slogger
+	newSSHClient = func(_ context.Context, _ connstr.ConnInfo, _ *rconf.Options) (sshClient, error) {
+		return client, nil
+	}
+	slogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	t.Cleanup(func() {
+		newSSHClient, slogger = prevClient, prevLogger
+	})
+}
+
+func TestReadScriptsIntoMemoryOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	names := []string{"05-users.sh", "00-packages.sh", "03-sshd.sh", "01-timezone.sh", "04-sysctl.sh", "02-locale.sh"}
+	for _, name := range names {
+		assert.NoError(t, os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0o600))
+	}
+
+	want := []string{
+		filepath.Join(tempDir, "00-packages.sh"),
+		filepath.Join(tempDir, "01-timezone.sh"),
+		filepath.Join(tempDir, "02-locale.sh"),
+		filepath.Join(tempDir, "03-sshd.sh"),
+		filepath.Join(tempDir, "04-sysctl.sh"),
+		filepath.Join(tempDir, "05-users.sh"),
+	}
+
+	for i := 0; i < 100; i++ {
+		scripts, err := readScriptsIntoMemory([]string{tempDir}, true, resolver.FileExtensions)
+		assert.NoError(t, err)
+
+		got := make([]string, 0, len(scripts))
+		for _, s := range scripts {
+			got = append(got, s.Path)
+			assert.Equal(t, filepath.Base(s.Path), string(s.Content))
+		}
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestProcessHostScriptOrder(t *testing.T) {
+	scripts := make([]Script, 0, 20)
+	want := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("%02d-step.sh", i)
+		scripts = append(scripts, Script{Path: name, Content: []byte(name)})
+		want = append(want, "/tmp/"+name)
+	}
+
+	for i := 0; i < 100; i++ {
+		client := &fakeClient{}
+		useFakeClient(t, client)
+
+		result := runTestHost(scripts)
+
+		assert.Equal(t, want, client.uploaded)
+		assert.Equal(t, want, client.executed)
+		assert.Equal(t, StatusSuccess, result.Status)
+		assert.Len(t, result.Scripts, len(scripts))
+		for i, s := range result.Scripts {
+			assert.Equal(t, scripts[i].Path, s.Script)
+			assert.Equal(t, StatusSuccess, s.Status)
+			assert.Equal(t, 0, s.ExitCode)
+		}
+	}
+}
+
+// runTestHost processes a single host with the given scripts
+func runTestHost(scripts []Script) *HostResult {
+	return runTestTask(context.Background(), &HostTask{Scripts: scripts})
+}
+
+// runTestTask processes the task as a single host
+func runTestTask(ctx context.Context, task *HostTask) *HostResult {
+	var wg sync.WaitGroup
+	task.Host, task.Port = "localhost", "22"
+	task.Result = &HostResult{Host: "localhost:22"}
+	task.wg = &wg
+	if task.RemoteDir == "" {
+		task.RemoteDir = "/tmp"
+	}
+	if task.semaphore == nil {
+		task.semaphore = make(chan struct{}, 1)
+	}
+	wg.Add(1)
+	processHost(ctx, task)
+	wg.Wait()
+	return task.Result
+}
+
+func TestProcessHostResult(t *testing.T) {
+	client := &fakeClient{failures: map[string]error{"/tmp/01-fail.sh": errors.New("boom")}}
+	useFakeClient(t, client)
+
+	result := runTestHost([]Script{{Path: "00-ok.sh"}, {Path: "01-fail.sh"}, {Path: "02-ok.sh"}})
+
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, []string{"01-fail.sh"}, result.failedScripts())
+	assert.Equal(t, StatusSuccess, result.Scripts[0].Status)
+	assert.Equal(t, StatusFailed, result.Scripts[1].Status)
+	assert.Equal(t, -1, result.Scripts[1].ExitCode)
+	assert.Equal(t, "boom", result.Scripts[1].Error)
+	assert.Equal(t, "out /tmp/01-fail.sh", result.Scripts[1].Stdout)
+	assert.Equal(t, "err /tmp/01-fail.sh", result.Scripts[1].Stderr)
+	// the remaining scripts are not run
+	assert.Equal(t, StatusSkipped, result.Scripts[2].Status)
+	assert.Equal(t, "not run: 01-fail.sh failed", result.Scripts[2].Error)
+	assert.Equal(t, []string{"/tmp/00-ok.sh", "/tmp/01-fail.sh"}, client.executed)
+	assert.False(t, result.Start.IsZero())
+	assert.False(t, result.End.Before(result.Start))
+
+	// the summary lists the failed and the skipped scripts
+	var out bytes.Buffer
+	printSummary(&out, &Result{Hosts: []*HostResult{result}})
+	assert.Contains(t, out.String(), "❌ Failed: 01-fail.sh")
+	assert.Contains(t, out.String(), "⏭️ Skipped: 02-ok.sh")
+}
+
+func TestPrintSummary(t *testing.T) {
+	result := &Result{Hosts: []*HostResult{
+		{Host: "web1:22", Status: StatusFailed, Scripts: []*ScriptResult{
+			{Script: "00-ok.sh", Status: StatusSuccess},
+			{Script: "01-fail.sh", Status: StatusFailed},
+			{Script: "02-next.sh", Status: StatusSkipped},
+			{Script: "03-last.sh", Status: StatusSkipped},
+		}},
+		{Host: "web2:22", Status: StatusSuccess, Scripts: []*ScriptResult{{Script: "00-ok.sh", Status: StatusSuccess}}},
+		{Host: "web3:22", Status: StatusSkipped, Error: "not started: failed hosts: 1 (allowed: 0)", Scripts: []*ScriptResult{
+			{Script: "00-ok.sh", Status: StatusSkipped},
+		}},
+		{Host: "web4:22", Status: StatusFailed, Error: "failed to gather facts: sh: 1: uname: not found", Scripts: []*ScriptResult{
+			{Script: "00-ok.sh", Status: StatusSkipped},
+		}},
+	}}
+
+	var out bytes.Buffer
+	printSummary(&out, result)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 8)
+	assert.Regexp(t, `^web1:22\s+❌ Failed: 01-fail.sh\s+0s$`, lines[2])
+	assert.Regexp(t, `^\s+⏭️ Skipped: 02-next.sh, 03-last.sh$`, lines[3])
+	assert.Regexp(t, `^web2:22\s+✅ Success\s+0s$`, lines[4])
+	// a host that was not started is not listed script by script
+	assert.Regexp(t, `^web3:22\s+⏭️ Skipped: not started: failed hosts: 1 \(allowed: 0\)\s+0s$`, lines[5])
+	// a host that failed before its scripts shows the reason
+	assert.Regexp(t, `^web4:22\s+❌ Failed: failed to gather facts: sh: 1: uname: not found\s+0s$`, lines[6])
+	assert.Regexp(t, `^\s+⏭️ Skipped: 00-ok.sh$`, lines[7])
+}
+
+func TestProcessHostOnError(t *testing.T) {
+	tests := []struct {
+		name            string
+		continueOnError bool
+		onError         string // policy of the failed script
+		want            Status // status of the script after the failed one
+	}{
+		{name: "default stops", want: StatusSkipped},
+		{name: "continue-on-error", continueOnError: true, want: StatusSuccess},
+		{name: "script continues", onError: OnErrorContinue, want: StatusSuccess},
+		{name: "script stops", continueOnError: true, onError: OnErrorStop, want: StatusSkipped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeClient(t, &fakeClient{failures: map[string]error{"/tmp/00-fail.sh": errors.New("boom")}})
+
+			result := runTestTask(context.Background(), &HostTask{
+				Scripts:         []Script{{Path: "00-fail.sh", OnError: tt.onError}, {Path: "01-ok.sh"}},
+				ContinueOnError: tt.continueOnError,
+			})
+
+			assert.Equal(t, StatusFailed, result.Status)
+			assert.Equal(t, StatusFailed, result.Scripts[0].Status)
+			assert.Equal(t, tt.want, result.Scripts[1].Status)
+		})
+	}
+}
+
+func TestProcessHostConnectionFailed(t *testing.T) {
+	useFakeClient(t, nil)
+	newSSHClient = func(_ context.Context, _ connstr.ConnInfo, _ *rconf.Options) (sshClient, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	result := runTestHost([]Script{{Path: "00-ok.sh"}})
+
+	assert.Equal(t, StatusConnFailed, result.Status)
+	assert.Equal(t, "connection refused", result.Error)
+	assert.Empty(t, result.Scripts)
+}
+
+func TestProcessHostScriptTimeout(t *testing.T) {
+	client := &fakeClient{delays: map[string]time.Duration{"/tmp/01-hang.sh": time.Minute}}
+	useFakeClient(t, client)
+
+	result := runTestTask(context.Background(), &HostTask{
+		Scripts:         []Script{{Path: "00-ok.sh"}, {Path: "01-hang.sh"}, {Path: "02-ok.sh"}},
+		ScriptTimeout:   50 * time.Millisecond,
+		ContinueOnError: true,
+	})
+
+	assert.Equal(t, StatusTimeout, result.Status)
+	assert.Equal(t, []string{"01-hang.sh"}, result.failedScripts())
+	assert.Equal(t, StatusTimeout, result.Scripts[1].Status)
+	assert.Equal(t, -1, result.Scripts[1].ExitCode)
+	assert.Equal(t, "script timeout (50ms) exceeded", result.Scripts[1].Error)
+	assert.Equal(t, "out /tmp/01-hang.sh", result.Scripts[1].Stdout)
+	// the host goes on with the next script (--continue-on-error)
+	assert.Equal(t, StatusSuccess, result.Scripts[2].Status)
+	assert.Equal(t, []string{"/tmp/00-ok.sh", "/tmp/01-hang.sh", "/tmp/02-ok.sh"}, client.executed)
+}
+
+func TestProcessHostTimeout(t *testing.T) {
+	client := &fakeClient{delays: map[string]time.Duration{"/tmp/01-hang.sh": time.Minute}}
+	useFakeClient(t, client)
+
+	result := runTestTask(context.Background(), &HostTask{
+		Scripts:     []Script{{Path: "00-ok.sh"}, {Path: "01-hang.sh"}, {Path: "02-ok.sh"}},
+		HostTimeout: 50 * time.Millisecond,
+	})
+
+	assert.Equal(t, StatusTimeout, result.Status)
+	assert.Equal(t, StatusSuccess, result.Scripts[0].Status)
+	assert.Equal(t, StatusTimeout, result.Scripts[1].Status)
+	assert.Equal(t, "host timeout (50ms) exceeded", result.Scripts[1].Error)
+	// the remaining scripts are not executed
+	assert.Equal(t, StatusSkipped, result.Scripts[2].Status)
+	assert.Equal(t, "host timeout (50ms) exceeded", result.Scripts[2].Error)
+	assert.Equal(t, []string{"/tmp/00-ok.sh", "/tmp/01-hang.sh"}, client.executed)
+}
+
+func TestProcessHostDeadline(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+
+	ctx, cancel := context.WithTimeoutCause(context.Background(), time.Millisecond, errors.New("run deadline (1ms) exceeded"))
+	defer cancel()
+	<-ctx.Done()
+
+	// all workers are busy until the deadline
+	sem := make(chan struct{}, 1)
+	sem <- struct{}{}
+	result := runTestTask(ctx, &HostTask{Scripts: []Script{{Path: "00-ok.sh"}}, semaphore: sem})
+
+	assert.Equal(t, StatusTimeout, result.Status)
+	assert.Equal(t, "run deadline (1ms) exceeded", result.Error)
+	assert.Empty(t, result.Scripts)
+	assert.Equal(t, ExitPartialFailure, ExitCode((&Result{Hosts: []*HostResult{result}}).Err()))
+}
+
+func TestProcessHostCanceled(t *testing.T) {
+	client := &fakeClient{delays: map[string]time.Duration{"/tmp/01-hang.sh": time.Minute}}
+	useFakeClient(t, client)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel(errors.New("canceled by interrupt signal"))
+	}()
+
+	result := runTestTask(ctx, &HostTask{Scripts: []Script{{Path: "00-ok.sh"}, {Path: "01-hang.sh"}, {Path: "02-ok.sh"}}})
+
+	assert.Equal(t, StatusCanceled, result.Status)
+	assert.Equal(t, StatusSuccess, result.Scripts[0].Status)
+	assert.Equal(t, StatusCanceled, result.Scripts[1].Status)
+	assert.Equal(t, "canceled by interrupt signal", result.Scripts[1].Error)
+	assert.Equal(t, StatusSkipped, result.Scripts[2].Status)
+	assert.Equal(t, []string{"/tmp/00-ok.sh", "/tmp/01-hang.sh"}, client.executed)
+	assert.Equal(t, ExitInterrupted, ExitCode((&Result{Hosts: []*HostResult{result}}).Err()))
+}
+
+// cancelClient cancels the run once the host is connected, before its first script
+type cancelClient struct {
+	fakeClient
+	cancel context.CancelCauseFunc
+}
+
+func (c *cancelClient) CreateDir(path string, mode os.FileMode) error {
+	c.cancel(errors.New("canceled by interrupt signal"))
+	return c.fakeClient.CreateDir(path, mode)
+}
+
+func TestProcessHostCanceledBeforeScripts(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	client := &cancelClient{cancel: cancel}
+	useFakeClient(t, client)
+
+	result := runTestTask(ctx, &HostTask{Scripts: []Script{{Path: "00-ok.sh"}, {Path: "01-ok.sh"}}})
+
+	// no script ran: the host is canceled, not successful
+	assert.Equal(t, StatusCanceled, result.Status)
+	assert.Equal(t, "canceled by interrupt signal", result.Error)
+	assert.Equal(t, []string{"00-ok.sh", "01-ok.sh"}, result.skippedScripts())
+	assert.Empty(t, client.executed)
+	assert.Equal(t, ExitInterrupted, ExitCode((&Result{Hosts: []*HostResult{result}}).Err()))
+}
+
+func TestProcessHostCommand(t *testing.T) {
+	client := &fakeClient{failures: map[string]error{"exit 3": errors.New("exit status 3")}}
+	useFakeClient(t, client)
+
+	scripts, err := readScripts(&cmd.Config{Command: "systemctl restart nginx", Filenames: []string{"ignored.sh"}})
+	assert.NoError(t, err)
+	result := runTestHost(scripts)
+
+	assert.Equal(t, StatusSuccess, result.Status)
+	assert.Empty(t, client.uploaded)
+	assert.Equal(t, []string{"systemctl restart nginx"}, client.executed)
+	assert.Equal(t, "systemctl restart nginx", result.Scripts[0].Script)
+	assert.Equal(t, "out systemctl restart nginx", result.Scripts[0].Stdout)
+
+	result = runTestHost([]Script{{Path: "exit 3", Command: "exit 3"}})
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, []string{"exit 3"}, result.failedScripts())
 }
@@ -0,0 +1,194 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rollout runs the hosts in batches (--serial): a batch starts when the previous one is done,
+// and the failed hosts are within the limit. Between batches, the rollout pauses and asks for confirmation
+// when configured.
+type rollout struct {
+	batches  [][]*HostTask
+	pause    time.Duration
+	confirm  bool
+	failures *failureLimit
+}
+
+// confirmBatch asks on the terminal whether to start the next batch (replaced in tests).
+var confirmBatch = func(ctx context.Context, prompt string) (bool, error) {
+	return askYesNo(ctx, stdinAnswers(), prompt)
+}
+
+// stdinAnswers reads the answers of all the prompts of the run: a reader per prompt would lose
+// the lines it buffered ('yes | rconf --serial 1 --confirm ...').
+var stdinAnswers = sync.OnceValue(func() *answerReader { return newAnswerReader(os.Stdin) })
+
+// parseSerial returns the sizes of the batches: 'N' hosts or 'P%' of the hosts (rounded down, at least 1),
+// the last size is repeated until all hosts are covered ('1,5,25%' runs a canary host, then 5 hosts, then waves of 25%).
+func parseSerial(spec string, total int) ([]int, error) {
+	var sizes []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		var size int
+		if p, ok := strings.CutSuffix(part, "%"); ok {
+			percent, err := strconv.ParseFloat(p, 64)
+			if err != nil || percent <= 0 || percent > 100 {
+				return nil, fmt.Errorf("invalid --serial: %q (expected N or P%%, 0-100%%)", part)
+			}
+			size = max(int(float64(total)*percent/100), 1)
+		} else {
+			n, err := strconv.Atoi(part)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid --serial: %q (expected N or P%%)", part)
+			}
+			size = n
+		}
+		sizes = append(sizes, size)
+	}
+
+	var batches []int
+	for remaining, i := total, 0; remaining > 0; i++ {
+		size := min(sizes[min(i, len(sizes)-1)], remaining)
+		batches = append(batches, size)
+		remaining -= size
+	}
+	return batches, nil
+}
+
+// newRollout splits the tasks into batches, a single batch when spec is empty
+func newRollout(tasks []*HostTask, spec string, pause time.Duration, confirm bool, failures *failureLimit) (*rollout, error) {
+	r := &rollout{pause: pause, confirm: confirm, failures: failures}
+	if strings.TrimSpace(spec) == "" {
+		r.batches = [][]*HostTask{tasks}
+		return r, nil
+	}
+	sizes, err := parseSerial(spec, len(tasks))
+	if err != nil {
+		return nil, err
+	}
+	for _, size := range sizes {
+		r.batches = append(r.batches, tasks[:size])
+		tasks = tasks[size:]
+	}
+	return r, nil
+}
+
+// run starts the batches in turn, process handles a host and marks the wait group as done.
+// The hosts of the batches that are not started are skipped (or stopped when the context is done).
+// It returns the number of hosts skipped because a batch was not confirmed.
+func (r *rollout) run(ctx context.Context, wg *sync.WaitGroup, process func(context.Context, *HostTask)) int {
+	for i, batch := range r.batches {
+		if i > 0 {
+			if reason := r.next(ctx, i); reason != "" {
+				declined := 0
+				for _, rest := range r.batches[i:] {
+					for _, task := range rest {
+						skipHost(task, reason)
+						declined++
+					}
+				}
+				return declined
+			}
+		}
+		if len(r.batches) > 1 {
+			fmt.Printf("\n🌊 Batch %d/%d: %d hosts\n", i+1, len(r.batches), len(batch))
+		}
+		for _, task := range batch {
+			wg.Add(1)
+			go process(ctx, task)
+		}
+		wg.Wait()
+	}
+	return 0
+}
+
+// next waits before the batch i, it returns the reason to stop the rollout, or an empty string.
+// When the failure limit is exceeded or the context is done, the remaining hosts are handled by process.
+func (r *rollout) next(ctx context.Context, i int) string {
+	if ctx.Err() != nil || r.failures.exceeded() != "" {
+		return ""
+	}
+	if r.pause > 0 {
+		fmt.Printf("\n⏸️ Pausing %s before batch %d/%d...\n", r.pause, i+1, len(r.batches))
+		select {
+		case <-time.After(r.pause):
+		case <-ctx.Done():
+			return ""
+		}
+	}
+	if r.confirm {
+		ok, err := confirmBatch(ctx, fmt.Sprintf("Start batch %d/%d (%d hosts)? [y/N] ", i+1, len(r.batches), len(r.batches[i])))
+		if err != nil {
+			return fmt.Sprintf("rollout stopped before batch %d: %s", i+1, err)
+		}
+		if !ok {
+			return fmt.Sprintf("rollout stopped before batch %d", i+1)
+		}
+	}
+	return ""
+}
+
+// answerReader reads the answers line by line. A line is read only when a prompt asks for it; when the prompt
+// is canceled, the pending read is kept and its line answers the next prompt, so that no line is lost and
+// a single read is blocked on the input at most.
+type answerReader struct {
+	in      *bufio.Reader
+	pending chan answer
+}
+
+type answer struct {
+	line string
+	err  error
+}
+
+func newAnswerReader(in io.Reader) *answerReader {
+	return &answerReader{in: bufio.NewReader(in)}
+}
+
+// readLine returns the next line, or the error of the input, or the cause of the context when it is done first
+func (r *answerReader) readLine(ctx context.Context) (string, error) {
+	if r.pending == nil {
+		pending := make(chan answer, 1)
+		go func() {
+			line, err := r.in.ReadString('\n')
+			if err != nil && line != "" {
+				err = nil
+			}
+			pending <- answer{line: line, err: err}
+		}()
+		r.pending = pending
+	}
+	select {
+	case a := <-r.pending:
+		r.pending = nil
+		return a.line, a.err
+	case <-ctx.Done():
+		return "", context.Cause(ctx)
+	}
+}
+
+// askYesNo prints the prompt and reads the answer, only 'y' and 'yes' confirm
+func askYesNo(ctx context.Context, answers *answerReader, prompt string) (bool, error) {
+	fmt.Print(prompt)
+	line, err := answers.readLine(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Println()
+			return false, err
+		}
+		return false, fmt.Errorf("failed to read the answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
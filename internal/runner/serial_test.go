@@ -0,0 +1,179 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSerial(t *testing.T) {
+	tests := []struct {
+		spec    string
+		total   int
+		want    []int
+		wantErr bool
+	}{
+		{spec: "1", total: 3, want: []int{1, 1, 1}},
+		{spec: "1,5,25%", total: 20, want: []int{1, 5, 5, 5, 4}},
+		{spec: "2,50%", total: 5, want: []int{2, 2, 1}},
+		{spec: "10%", total: 5, want: []int{1, 1, 1, 1, 1}},
+		{spec: "100%", total: 4, want: []int{4}},
+		{spec: "10", total: 3, want: []int{3}},
+		{spec: "1, 2", total: 4, want: []int{1, 2, 1}},
+		{spec: "0", wantErr: true},
+		{spec: "abc", wantErr: true},
+		{spec: "1,,2", wantErr: true},
+		{spec: "0%", wantErr: true},
+		{spec: "150%", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseSerial(tt.spec, tt.total)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// runTestRollout processes the hosts in batches of the spec, failed scripts fail every host.
+// It returns the results of the hosts and the number of hosts skipped because a batch was not confirmed.
+func runTestRollout(t *testing.T, spec string, count int, failures *failureLimit, client *fakeClient) ([]*HostResult, int) {
+	t.Helper()
+	useFakeClient(t, client)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 2)
+	tasks := make([]*HostTask, 0, count)
+	results := make([]*HostResult, 0, count)
+	for i := 0; i < count; i++ {
+		task := &HostTask{
+			Host:      fmt.Sprintf("10.0.0.%d", i+1),
+			Port:      "22",
+			RemoteDir: "/tmp",
+			Scripts:   []Script{{Path: "00-fail.sh"}},
+			Result:    &HostResult{Host: fmt.Sprintf("10.0.0.%d:22", i+1)},
+			wg:        &wg,
+			semaphore: sem,
+			failures:  failures,
+		}
+		tasks = append(tasks, task)
+		results = append(results, task.Result)
+	}
+	r, err := newRollout(tasks, spec, 0, failures != nil, failures)
+	require.NoError(t, err)
+	declined := r.run(context.Background(), &wg, processHost)
+	return results, declined
+}
+
+func TestRolloutCanaryFails(t *testing.T) {
+	client := &fakeClient{failures: map[string]error{"/tmp/00-fail.sh": errors.New("boom")}}
+	results, declined := runTestRollout(t, "1,2", 5, newFailureLimit(0), client)
+
+	assert.Zero(t, declined)
+	assert.Equal(t, StatusFailed, results[0].Status)
+	for _, r := range results[1:] {
+		assert.Equal(t, StatusSkipped, r.Status)
+		assert.Equal(t, "not started: failed hosts: 1 (allowed: 0)", r.Error)
+	}
+	assert.Len(t, client.executed, 1)
+}
+
+func TestRolloutFailureThreshold(t *testing.T) {
+	client := &fakeClient{failures: map[string]error{"/tmp/00-fail.sh": errors.New("boom")}}
+	prev := confirmBatch
+	confirmBatch = func(context.Context, string) (bool, error) { return true, nil }
+	t.Cleanup(func() { confirmBatch = prev })
+
+	// 1 failure tolerated: the canary fails, the next batch starts, then the rollout stops
+	results, declined := runTestRollout(t, "1,2", 5, newFailureLimit(1), client)
+
+	assert.Equal(t, StatusFailed, results[0].Status)
+	assert.GreaterOrEqual(t, countStatuses(results)[StatusFailed], 2)
+	assert.Equal(t, StatusSkipped, results[3].Status)
+	assert.Equal(t, StatusSkipped, results[4].Status)
+	assert.Zero(t, declined)
+}
+
+func TestRolloutConfirm(t *testing.T) {
+	var prompts []string
+	prev := confirmBatch
+	confirmBatch = func(_ context.Context, prompt string) (bool, error) {
+		prompts = append(prompts, prompt)
+		return len(prompts) < 2, nil
+	}
+	t.Cleanup(func() { confirmBatch = prev })
+
+	client := &fakeClient{}
+	results, declined := runTestRollout(t, "1,2", 5, newFailureLimit(0), client)
+
+	assert.Equal(t, []string{"Start batch 2/3 (2 hosts)? [y/N] ", "Start batch 3/3 (2 hosts)? [y/N] "}, prompts)
+	assert.Equal(t, map[Status]int{StatusSuccess: 3, StatusSkipped: 2}, countStatuses(results))
+	assert.Equal(t, "rollout stopped before batch 3", results[4].Error)
+
+	// a declined batch is not a success
+	assert.Equal(t, 2, declined)
+	err := (&Result{Hosts: results, Declined: declined}).Err()
+	assert.EqualError(t, err, "rollout stopped: 2 of 5 hosts were not run")
+	assert.Equal(t, ExitStopped, ExitCode(err))
+}
+
+func TestAskYesNo(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"y", true},
+	}
+	for _, tt := range tests {
+		got, err := askYesNo(context.Background(), newAnswerReader(strings.NewReader(tt.input)), "")
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.input)
+	}
+
+	_, err := askYesNo(context.Background(), newAnswerReader(strings.NewReader("")), "")
+	assert.ErrorContains(t, err, "failed to read the answer")
+}
+
+func TestAskYesNoPromptsShareInput(t *testing.T) {
+	// piped answers: each prompt takes its own line ('printf 'y\nn\ny\n' | rconf ...')
+	answers := newAnswerReader(strings.NewReader("y\nn\ny\n"))
+	for _, want := range []bool{true, false, true} {
+		got, err := askYesNo(context.Background(), answers, "")
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := askYesNo(context.Background(), answers, "")
+	assert.ErrorContains(t, err, "failed to read the answer")
+}
+
+func TestAskYesNoCanceled(t *testing.T) {
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	answers := newAnswerReader(r)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errors.New("canceled by interrupt signal"))
+	_, err := askYesNo(ctx, answers, "")
+	assert.EqualError(t, err, "canceled by interrupt signal")
+
+	// the pending read is kept: its line answers the next prompt
+	go func() { _, _ = io.WriteString(w, "y\n") }()
+	got, err := askYesNo(context.Background(), answers, "")
+	require.NoError(t, err)
+	assert.True(t, got)
+}
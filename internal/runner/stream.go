@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+)
+
+// outputMu serializes the streamed lines of all hosts
+var outputMu sync.Mutex
+
+// prefixWriter writes complete lines with a prefix, so that the output of concurrent hosts
+// is interleaved line by line, never within a line.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return len(data), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// Flush writes the last line when it has no trailing newline.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	_, err := p.w.Write(append([]byte(p.prefix), line...))
+	return err
+}
+
+// hostStream returns the stream printing the remote output of the host to stdout and stderr,
+// and the function flushing the incomplete lines.
+func hostStream(host string) (*rconf.Stream, func()) {
+	prefix := "[HOST: " + host + "] "
+	stdout := &prefixWriter{w: os.Stdout, prefix: prefix}
+	stderr := &prefixWriter{w: os.Stderr, prefix: prefix}
+	return &rconf.Stream{Stdout: stdout, Stderr: stderr}, func() {
+		_ = stdout.Flush()
+		_ = stderr.Flush()
+	}
+}
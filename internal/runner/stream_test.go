@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{w: &out, prefix: "[HOST: db1:22] "}
+
+	for _, chunk := range []string{"Reading pack", "age lists...\nDone\n", "\nBuilding", " tree"} {
+		n, err := w.Write([]byte(chunk))
+		assert.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	assert.Equal(t, "[HOST: db1:22] Reading package lists...\n[HOST: db1:22] Done\n[HOST: db1:22] \n", out.String())
+
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "[HOST: db1:22] Reading package lists...\n[HOST: db1:22] Done\n[HOST: db1:22] \n[HOST: db1:22] Building tree\n", out.String())
+
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, 4, strings.Count(out.String(), "\n"))
+}
+
+func TestPrefixWriterConcurrentHosts(t *testing.T) {
+	var out bytes.Buffer
+	var wg sync.WaitGroup
+	for h := 0; h < 8; h++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := &prefixWriter{w: &out, prefix: fmt.Sprintf("[host%d] ", h)}
+			for i := 0; i < 100; i++ {
+				// a line split across writes must not be interleaved with other hosts
+				_, _ = w.Write([]byte(fmt.Sprintf("host%d ", h)))
+				_, _ = w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 800)
+	for _, line := range lines {
+		var prefixHost, host, i int
+		_, err := fmt.Sscanf(line, "[host%d] host%d line %d", &prefixHost, &host, &i)
+		assert.NoError(t, err, line)
+		assert.Equal(t, prefixHost, host, line)
+	}
+}
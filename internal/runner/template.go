@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/hashmap-kz/rconf/internal/resolver"
+	rconf "github.com/hashmap-kz/rconf/internal/sshclient"
+	"gopkg.in/yaml.v3"
+)
+
+// templateData is the data of a script template:
+//
+//	{{ .Host }}, {{ .Address }}, {{ .Port }}, {{ .User }}, {{ .Groups }},
+//	{{ .Vars.role }}, {{ .Facts.distro }}
+type templateData struct {
+	Host    string            // the inventory name, or the --conn host
+	Address string            // the address used to connect
+	Port    string            // the ssh port
+	User    string            // the ssh user
+	Groups  []string          // inventory groups
+	Vars    map[string]any    // host and group variables, --vars-file, --var (a list when set more than once)
+	Facts   map[string]string // gathered from the host, see factKeys
+}
+
+// templateFuncs are the functions available to the script templates
+var templateFuncs = template.FuncMap{
+	"quote": shellQuote,
+	"join":  strings.Join,
+}
+
+// parseTemplates parses the scripts with the template extension (or all scripts when all is set).
+// The templates are named after the script, so that errors point to file:line.
+func parseTemplates(scripts []Script, all bool) error {
+	for i := range scripts {
+		s := &scripts[i]
+		if !all && !strings.HasSuffix(s.Path, resolver.TemplateExtension) {
+			continue
+		}
+		tmpl, err := template.New(s.Path).Option("missingkey=error").Funcs(templateFuncs).Parse(string(s.Content))
+		if err != nil {
+			return err
+		}
+		s.Template = tmpl
+	}
+	return nil
+}
+
+// usesFacts reports whether a template refers to the facts, which are then gathered from every host
+func usesFacts(scripts []Script) bool {
+	for _, s := range scripts {
+		if s.Template != nil && bytes.Contains(s.Content, []byte(".Facts")) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadExtraVars reads the --vars-file files (YAML mappings, later files win), then the --var key=value pairs.
+func loadExtraVars(files, pairs []string) (map[string]any, error) {
+	vars := map[string]any{}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var fileVars map[string]any
+		if err := yaml.Unmarshal(data, &fileVars); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		maps.Copy(vars, fileVars)
+	}
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid variable: %q (expected key=value)", p)
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// newTemplateData returns the template data of the host, the extra variables win over the host ones
+func newTemplateData(h *hostEntry, extraVars map[string]any) *templateData {
+	vars := make(map[string]any, len(h.Vars)+len(extraVars))
+	for k, v := range h.Vars {
+		if len(v) == 1 {
+			vars[k] = v[0]
+		} else {
+			vars[k] = v
+		}
+	}
+	maps.Copy(vars, extraVars)
+
+	groups := h.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	return &templateData{
+		Host:    h.Name,
+		Address: h.ConnInfo.Host,
+		Port:    h.ConnInfo.Port,
+		User:    h.ConnInfo.User,
+		Groups:  groups,
+		Vars:    vars,
+	}
+}
+
+// renderScript returns the content of the script for the host
+func renderScript(script Script, data *templateData) ([]byte, error) {
+	if script.Template == nil {
+		return script.Content, nil
+	}
+	var buf bytes.Buffer
+	if err := script.Template.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkTemplates renders the templates for every host before the run, with empty facts,
+// so that a missing variable is reported before any host is touched.
+func checkTemplates(scripts []Script, tasks []*HostTask) error {
+	for _, task := range tasks {
+		data := *task.TemplateData
+		data.Facts = placeholderFacts()
+		for _, s := range scripts {
+			if _, err := renderScript(s, &data); err != nil {
+				return fmt.Errorf("%w (host %s)", err, data.Host)
+			}
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes any value for the shell
+func shellQuote(v any) string {
+	return rconf.ShellQuote(fmt.Sprint(v))
+}
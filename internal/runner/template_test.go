@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTemplates(t *testing.T) {
+	scripts := []Script{
+		{Path: "00-plain.sh", Content: []byte("echo {{ not a template")},
+		{Path: "01-motd.sh.tmpl", Content: []byte("echo {{ .Host }}")},
+	}
+	require.NoError(t, parseTemplates(scripts, false))
+	assert.Nil(t, scripts[0].Template)
+	assert.NotNil(t, scripts[1].Template)
+
+	// --template renders all scripts
+	err := parseTemplates(scripts, true)
+	assert.ErrorContains(t, err, "00-plain.sh:1:")
+
+	bad := []Script{{Path: "scripts/02-bad.sh.tmpl", Content: []byte("#!/bin/sh\necho {{ .Host }\n")}}
+	err = parseTemplates(bad, false)
+	assert.ErrorContains(t, err, "scripts/02-bad.sh.tmpl:2:")
+}
+
+func TestLoadExtraVars(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.yml")
+	second := filepath.Join(dir, "second.yml")
+	require.NoError(t, os.WriteFile(first, []byte("cluster: main\nreplicas: 3\nzones: [a, b]\n"), 0o600))
+	require.NoError(t, os.WriteFile(second, []byte("cluster: backup\n"), 0o600))
+
+	vars, err := loadExtraVars([]string{first, second}, []string{"replicas=5", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"cluster":  "backup",
+		"replicas": "5",
+		"zones":    []any{"a", "b"},
+		"empty":    "",
+	}, vars)
+
+	_, err = loadExtraVars(nil, []string{"novalue"})
+	assert.Error(t, err)
+	_, err = loadExtraVars([]string{filepath.Join(dir, "missing.yml")}, nil)
+	assert.Error(t, err)
+}
+
+func TestRenderScript(t *testing.T) {
+	host := &hostEntry{
+		Name:     "web1",
+		ConnInfo: &connstr.ConnInfo{User: "deploy", Host: "10.0.1.11", Port: "22"},
+		Groups:   []string{"prod", "web"},
+		Vars:     map[string][]string{"role": {"frontend"}, "dns": {"1.1.1.1", "8.8.8.8"}, "cluster": {"main"}},
+	}
+	data := newTemplateData(host, map[string]any{"cluster": "backup"})
+
+	scripts := []Script{{
+		Path: "motd.sh.tmpl",
+		Content: []byte(`{{ .Host }} {{ .User }}@{{ .Address }}:{{ .Port }} {{ join .Groups "," }} ` +
+			`{{ .Vars.role }} {{ .Vars.cluster }} {{ range .Vars.dns }}{{ . }} {{ end }}{{ quote "it's" }}`),
+	}}
+	require.NoError(t, parseTemplates(scripts, false))
+
+	content, err := renderScript(scripts[0], data)
+	require.NoError(t, err)
+	assert.Equal(t, `web1 deploy@10.0.1.11:22 prod,web frontend backup 1.1.1.1 8.8.8.8 'it'\''s'`, string(content))
+
+	plain := Script{Path: "plain.sh", Content: []byte("echo {{ .Host }}")}
+	content, err = renderScript(plain, data)
+	require.NoError(t, err)
+	assert.Equal(t, "echo {{ .Host }}", string(content))
+}
+
+func TestCheckTemplates(t *testing.T) {
+	scripts := []Script{{Path: "role.sh.tmpl", Content: []byte("#!/bin/sh\n\necho {{ .Vars.role }} {{ .Facts.distro }}\n")}}
+	require.NoError(t, parseTemplates(scripts, false))
+
+	withRole := &HostTask{TemplateData: newTemplateData(&hostEntry{
+		Name: "web1", ConnInfo: &connstr.ConnInfo{}, Vars: map[string][]string{"role": {"web"}},
+	}, nil)}
+	withoutRole := &HostTask{TemplateData: newTemplateData(&hostEntry{Name: "db1", ConnInfo: &connstr.ConnInfo{}}, nil)}
+
+	assert.NoError(t, checkTemplates(scripts, []*HostTask{withRole}))
+
+	err := checkTemplates(scripts, []*HostTask{withRole, withoutRole})
+	assert.ErrorContains(t, err, "role.sh.tmpl:3:")
+	assert.ErrorContains(t, err, `map has no entry for key "role"`)
+	assert.ErrorContains(t, err, "(host db1)")
+
+	// unknown facts are reported too
+	scripts = []Script{{Path: "facts.sh.tmpl", Content: []byte("{{ .Facts.nope }}")}}
+	require.NoError(t, parseTemplates(scripts, false))
+	assert.ErrorContains(t, checkTemplates(scripts, []*HostTask{withRole}), "facts.sh.tmpl:1:")
+}
+
+func TestProcessHostTemplates(t *testing.T) {
+	client := &fakeClient{stdout: "hostname=web1\ndistro=debian\ndistro_version=12\nunknown=x\n"}
+	useFakeClient(t, client)
+
+	scripts := []Script{
+		{Path: "00-plain.sh", Content: []byte("echo {{ .Host }}")},
+		{Path: "01-motd.sh.tmpl", Content: []byte("echo {{ .Facts.hostname }} {{ .Facts.distro }} {{ .Facts.distro_version }} {{ .Facts.arch }}")},
+	}
+	require.NoError(t, parseTemplates(scripts, false))
+
+	result := runTestTask(context.Background(), &HostTask{
+		Scripts:      scripts,
+		TemplateData: newTemplateData(&hostEntry{Name: "web1", ConnInfo: &connstr.ConnInfo{}}, nil),
+		GatherFacts:  usesFacts(scripts),
+	})
+
+	assert.Equal(t, StatusSuccess, result.Status)
+	assert.Equal(t, []string{factsCommand}, client.commands)
+	assert.Equal(t, []string{"/tmp/00-plain.sh", "/tmp/01-motd.sh"}, client.uploaded)
+	assert.Equal(t, "echo {{ .Host }}", client.contents["/tmp/00-plain.sh"])
+	assert.Equal(t, "echo web1 debian 12 ", client.contents["/tmp/01-motd.sh"])
+}
+
+func TestProcessHostFactsFailed(t *testing.T) {
+	client := &fakeClient{failures: map[string]error{factsCommand: errors.New("exit status 127")}}
+	useFakeClient(t, client)
+
+	scripts := []Script{
+		{Path: "00-plain.sh", Content: []byte("echo {{ .Host }}")},
+		{Path: "01-motd.sh.tmpl", Content: []byte("echo {{ .Facts.hostname }}")},
+	}
+	require.NoError(t, parseTemplates(scripts, false))
+
+	result := runTestTask(context.Background(), &HostTask{
+		Scripts:      scripts,
+		TemplateData: newTemplateData(&hostEntry{Name: "web1", ConnInfo: &connstr.ConnInfo{}}, nil),
+		GatherFacts:  true,
+	})
+
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, "failed to gather facts: exit status 127", result.Error)
+	assert.Empty(t, client.uploaded)
+	// the scripts that did not run are listed as skipped
+	require.Len(t, result.Scripts, 2)
+	for _, s := range result.Scripts {
+		assert.Equal(t, StatusSkipped, s.Status)
+		assert.Equal(t, "not run: failed to gather facts: exit status 127", s.Error)
+	}
+}
+
+func TestParseFacts(t *testing.T) {
+	facts := parseFacts("os=Linux\n  arch=x86_64\nip=\nbogus\nother=1\n")
+	assert.Len(t, facts, len(factKeys))
+	assert.Equal(t, "Linux", facts["os"])
+	assert.Equal(t, "x86_64", facts["arch"])
+	assert.Equal(t, "", facts["ip"])
+	assert.NotContains(t, facts, "other")
+}
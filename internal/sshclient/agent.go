@@ -0,0 +1,23 @@
+package rconf
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// dialAgent connects to the ssh-agent listening on SSH_AUTH_SOCK.
+// The returned connection must be closed by the caller once the handshake is done.
+func dialAgent() (agent.ExtendedAgent, net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("ssh-agent auth requested, but SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	return agent.NewClient(conn), conn, nil
+}
@@ -0,0 +1,119 @@
+package rconf
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"golang.org/x/crypto/ssh"
+)
+
+// BastionPool shares jump host connections: sessions to targets behind the same
+// chain of jump hosts use one connection per hop, which is closed when the last target is done.
+type BastionPool struct {
+	mu    sync.Mutex
+	conns map[string]*bastionConn
+}
+
+type bastionConn struct {
+	client *ssh.Client
+	refs   int
+	ready  chan struct{} // closed when the connection attempt is finished
+	err    error
+}
+
+// NewBastionPool creates an empty pool.
+func NewBastionPool() *BastionPool {
+	return &BastionPool{conns: make(map[string]*bastionConn)}
+}
+
+// acquireChain connects (or reuses) every hop of the chain.
+// It returns the client of the last hop (nil without jump hosts) and the keys to release.
+func (p *BastionPool) acquireChain(ctx context.Context, hops []*connstr.ConnInfo, opts *Options) (*ssh.Client, []string, error) {
+	var via *ssh.Client
+	keys := make([]string, 0, len(hops))
+	for i := range hops {
+		hop := hops[i]
+		key := chainKey(hops[:i+1])
+		prev := via
+		client, err := p.acquire(ctx, key, func() (*ssh.Client, error) {
+			return dialSSH(ctx, prev, hop, opts, nil)
+		})
+		if err != nil {
+			p.releaseChain(keys)
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		via = client
+	}
+	return via, keys, nil
+}
+
+// releaseChain releases the hops in reverse order, the last user closes the connections.
+func (p *BastionPool) releaseChain(keys []string) {
+	for i := len(keys) - 1; i >= 0; i-- {
+		p.release(keys[i])
+	}
+}
+
+func (p *BastionPool) acquire(ctx context.Context, key string, dial func() (*ssh.Client, error)) (*ssh.Client, error) {
+	p.mu.Lock()
+	conn, ok := p.conns[key]
+	if ok {
+		conn.refs++
+		p.mu.Unlock()
+		select {
+		case <-conn.ready:
+		case <-ctx.Done():
+			p.release(key)
+			return nil, ctx.Err()
+		}
+		if conn.err != nil {
+			p.release(key)
+			return nil, conn.err
+		}
+		return conn.client, nil
+	}
+
+	// first user: dial without holding the lock, concurrent users wait for the result
+	conn = &bastionConn{refs: 1, ready: make(chan struct{})}
+	p.conns[key] = conn
+	p.mu.Unlock()
+
+	conn.client, conn.err = dial()
+	close(conn.ready)
+	if conn.err != nil {
+		p.release(key)
+		return nil, conn.err
+	}
+	return conn.client, nil
+}
+
+func (p *BastionPool) release(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn, ok := p.conns[key]
+	if !ok {
+		return
+	}
+	conn.refs--
+	if conn.refs > 0 {
+		return
+	}
+	delete(p.conns, key)
+	if conn.client != nil {
+		conn.client.Close()
+	}
+}
+
+// chainKey identifies a chain of hops, e.g. 'admin@bastion:22,admin@inner:22'
+func chainKey(hops []*connstr.ConnInfo) string {
+	parts := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		parts = append(parts, hop.User+"@"+net.JoinHostPort(hop.Host, hop.Port))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,135 @@
+package rconf
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hop returns the connection details of the server used as a jump host
+func (srv *testServer) hop() *connstr.ConnInfo {
+	info := srv.connInfo()
+	info.Password = srv.password
+	return &info
+}
+
+func TestNewSSHClientThroughSharedJumpHost(t *testing.T) {
+	priv, pub := newTestKey(t)
+	startTestAgent(t, priv)
+
+	bastion := newTestServer(t)
+	bastion.password = "bastion-secret"
+	targets := []*testServer{newTestServer(t), newTestServer(t), newTestServer(t)}
+
+	opts := &Options{UseAgent: true, Bastions: NewBastionPool()}
+
+	var wg sync.WaitGroup
+	clients := make([]*SSHClient, len(targets))
+	errs := make([]error, len(targets))
+	for i, target := range targets {
+		target.keys = []ssh.PublicKey{pub}
+		connInfo := target.connInfo()
+		connInfo.Jumps = []*connstr.ConnInfo{bastion.hop()}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], errs[i] = NewSSHClient(context.Background(), connInfo, opts)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range targets {
+		require.NoError(t, errs[i])
+		assert.NoError(t, clients[i].UploadScript([]byte("echo ok"), filepath.Join(t.TempDir(), "script.sh")))
+		assert.Equal(t, 1, targets[i].connectionCount())
+	}
+	assert.Equal(t, 1, bastion.connectionCount())
+
+	// the bastion connection is closed with the last target, and dialed again when needed
+	for _, c := range clients {
+		c.Close()
+	}
+	connInfo := targets[0].connInfo()
+	connInfo.Jumps = []*connstr.ConnInfo{bastion.hop()}
+	client, err := NewSSHClient(context.Background(), connInfo, opts)
+	require.NoError(t, err)
+	client.Close()
+	assert.Equal(t, 2, bastion.connectionCount())
+}
+
+func TestNewSSHClientThroughJumpChain(t *testing.T) {
+	outer := newTestServer(t)
+	outer.password = "outer-secret"
+	inner := newTestServer(t)
+	inner.password = "inner-secret"
+	target := newTestServer(t)
+	target.password = "target-secret"
+
+	connInfo := target.connInfo()
+	connInfo.Password = target.password
+	connInfo.Jumps = []*connstr.ConnInfo{outer.hop(), inner.hop()}
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.NoError(t, client.UploadScript([]byte("echo ok"), filepath.Join(t.TempDir(), "script.sh")))
+	assert.Equal(t, 1, outer.connectionCount())
+	assert.Equal(t, 1, inner.connectionCount())
+	assert.Equal(t, 1, target.connectionCount())
+}
+
+func TestNewSSHClientJumpHostChecks(t *testing.T) {
+	bastion := newTestServer(t)
+	bastion.password = "bastion-secret"
+	target := newTestServer(t)
+	target.password = "target-secret"
+
+	connInfo := target.connInfo()
+	connInfo.Password = target.password
+
+	t.Run("Jump host auth is separate", func(t *testing.T) {
+		hop := bastion.hop()
+		hop.Password = target.password
+		connInfo.Jumps = []*connstr.ConnInfo{hop}
+		_, err := NewSSHClient(context.Background(), connInfo, &Options{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Jump host key is verified", func(t *testing.T) {
+		// only the target is known
+		knownHosts := writeKnownHosts(t, knownhosts.Line([]string{knownhosts.Normalize(target.addr())}, target.hostKey.PublicKey()))
+		hop := bastion.hop()
+		hop.Opts = map[string][]string{}
+		connInfo.Jumps = []*connstr.ConnInfo{hop}
+
+		_, err := NewSSHClient(context.Background(), connInfo, &Options{KnownHostsPath: knownHosts})
+		assert.ErrorContains(t, err, "is not in")
+	})
+
+	t.Run("Target key is verified behind the jump host", func(t *testing.T) {
+		// only the bastion is known
+		knownHosts := writeKnownHosts(t, knownhosts.Line([]string{knownhosts.Normalize(bastion.addr())}, bastion.hostKey.PublicKey()))
+		hop := bastion.hop()
+		hop.Opts = map[string][]string{}
+		connInfo.Jumps = []*connstr.ConnInfo{hop}
+		target := connInfo
+		target.Opts = map[string][]string{}
+
+		_, err := NewSSHClient(context.Background(), target, &Options{KnownHostsPath: knownHosts})
+		assert.ErrorContains(t, err, "is not in")
+
+		target.Opts = map[string][]string{"hostkey": {HostKeyOff}}
+		client, err := NewSSHClient(context.Background(), target, &Options{KnownHostsPath: knownHosts})
+		require.NoError(t, err)
+		client.Close()
+	})
+}
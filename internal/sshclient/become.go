@@ -0,0 +1,99 @@
+package rconf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Privilege escalation methods of the 'become' opt.
+const (
+	BecomeSudo  = "sudo"
+	BecomeDoas  = "doas"
+	BecomeSu    = "su"
+	BecomePbrun = "pbrun"
+	BecomeNone  = "none"
+)
+
+var becomeMethods = []string{BecomeSudo, BecomeDoas, BecomeSu, BecomePbrun, BecomeNone}
+
+// BecomeMethod returns the escalation method of the opts: the become opt, or sudo unless sudo=false.
+func BecomeMethod(opts map[string][]string) string {
+	if method := getOpt(opts, "become"); method != "" {
+		return method
+	}
+	if hasOpt(opts, "sudo", "false") {
+		return BecomeNone
+	}
+	return BecomeSudo
+}
+
+// BecomeUser returns the user the scripts run as, empty for root.
+func BecomeUser(opts map[string][]string) string {
+	if user := getOpt(opts, "become_user"); user != "root" && BecomeMethod(opts) != BecomeNone {
+		return user
+	}
+	return ""
+}
+
+// ValidateBecome checks the escalation opts: the method, and the password (read by sudo only).
+func ValidateBecome(opts map[string][]string) error {
+	method := BecomeMethod(opts)
+	if !slices.Contains(becomeMethods, method) {
+		return fmt.Errorf("invalid 'become' opt: %q (available: %s)", method, strings.Join(becomeMethods, ", "))
+	}
+	if user := getOpt(opts, "become_user"); strings.ContainsAny(user, " \t'\"\\$`;&|<>") {
+		return fmt.Errorf("invalid 'become_user' opt: %q", user)
+	}
+	if getOpt(opts, BecomePassOpt) != "" && method != BecomeSudo && method != BecomeNone {
+		return fmt.Errorf("a become password is only supported with become=sudo (got %s)", method)
+	}
+	return nil
+}
+
+// becomeCommand returns the command line that runs the shell command with the escalation method of the opts
+func becomeCommand(command string, opts map[string][]string) string {
+	user := BecomeUser(opts)
+	switch BecomeMethod(opts) {
+	case BecomeNone:
+		return command
+	case BecomeDoas:
+		return "doas " + userFlag(user) + "sh -c " + ShellQuote(command)
+	case BecomeSu:
+		if user == "" {
+			user = "root"
+		}
+		return "su " + user + " -c " + ShellQuote(command)
+	case BecomePbrun:
+		return "pbrun " + userFlag(user) + "sh -c " + ShellQuote(command)
+	}
+	if getOpt(opts, BecomePassOpt) != "" {
+		return sudoWithPassword(command, user)
+	}
+	return "sudo " + userFlag(user) + "sh -c " + ShellQuote(command)
+}
+
+func userFlag(user string) string {
+	if user == "" {
+		return ""
+	}
+	return "-u " + user + " "
+}
+
+// sudoWithPassword returns the command line that runs the command with 'sudo -S': sudo always reads the password
+// (-k ignores cached credentials) without a prompt, then the command gets an empty stdin, so that
+// it never reads the password (e.g. when sudo does not ask for it).
+func sudoWithPassword(command, user string) string {
+	return "sudo -k -S -p '' " + userFlag(user) + "sh -c " + ShellQuote("exec </dev/null; "+command)
+}
+
+// becomeInput returns the stdin of the command: the sudo password, if any
+func becomeInput(opts map[string][]string) string {
+	if BecomeMethod(opts) != BecomeSudo {
+		return ""
+	}
+	if pass := getOpt(opts, BecomePassOpt); pass != "" {
+		return pass + "\n"
+	}
+	return ""
+}
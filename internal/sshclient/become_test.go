@@ -0,0 +1,93 @@
+package rconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBecomeCommands(t *testing.T) {
+	tests := []struct {
+		opts        map[string][]string
+		wantScript  string
+		wantCommand string
+	}{
+		{
+			opts:        nil,
+			wantScript:  "sudo chmod +x '/tmp/a.sh' && sudo '/tmp/a.sh'",
+			wantCommand: `sudo sh -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"become": {"none"}},
+			wantScript:  "chmod +x '/tmp/a.sh' && '/tmp/a.sh'",
+			wantCommand: "id -u",
+		},
+		{
+			opts:        map[string][]string{"become_user": {"postgres"}},
+			wantScript:  `chmod +x '/tmp/a.sh' && sudo -u postgres sh -c ''\''/tmp/a.sh'\'''`,
+			wantCommand: `sudo -u postgres sh -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"become_user": {"root"}},
+			wantScript:  "sudo chmod +x '/tmp/a.sh' && sudo '/tmp/a.sh'",
+			wantCommand: `sudo sh -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"become": {"doas"}},
+			wantScript:  `doas sh -c 'chmod +x '\''/tmp/a.sh'\'' && '\''/tmp/a.sh'\'''`,
+			wantCommand: `doas sh -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"become": {"doas"}, "become_user": {"www"}, "interpreter": {"/usr/bin/python3"}},
+			wantScript:  `doas -u www sh -c '/usr/bin/python3 '\''/tmp/a.sh'\'''`,
+			wantCommand: `doas -u www sh -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"become": {"su"}},
+			wantScript:  `su root -c 'chmod +x '\''/tmp/a.sh'\'' && '\''/tmp/a.sh'\'''`,
+			wantCommand: `su root -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"become": {"su"}, "become_user": {"postgres"}},
+			wantScript:  `chmod +x '/tmp/a.sh' && su postgres -c ''\''/tmp/a.sh'\'''`,
+			wantCommand: `su postgres -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"become": {"pbrun"}, "become_user": {"oracle"}},
+			wantScript:  `chmod +x '/tmp/a.sh' && pbrun -u oracle sh -c ''\''/tmp/a.sh'\'''`,
+			wantCommand: `pbrun -u oracle sh -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"become_user": {"postgres"}, BecomePassOpt: {"secret"}},
+			wantScript:  `chmod +x '/tmp/a.sh' && sudo -k -S -p '' -u postgres sh -c 'exec </dev/null; '\''/tmp/a.sh'\'''`,
+			wantCommand: `sudo -k -S -p '' -u postgres sh -c 'exec </dev/null; id -u'`,
+		},
+		{
+			// become wins over sudo, the user is ignored without escalation
+			opts:        map[string][]string{"sudo": {"false"}, "become": {"sudo"}},
+			wantScript:  "sudo chmod +x '/tmp/a.sh' && sudo '/tmp/a.sh'",
+			wantCommand: `sudo sh -c 'id -u'`,
+		},
+		{
+			opts:        map[string][]string{"sudo": {"false"}, "become_user": {"postgres"}},
+			wantScript:  "chmod +x '/tmp/a.sh' && '/tmp/a.sh'",
+			wantCommand: "id -u",
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.wantScript, ScriptCommand("/tmp/a.sh", tt.opts), tt.opts)
+		assert.Equal(t, tt.wantCommand, CommandLine("id -u", tt.opts), tt.opts)
+	}
+}
+
+func TestValidateBecome(t *testing.T) {
+	assert.NoError(t, ValidateBecome(nil))
+	assert.NoError(t, ValidateBecome(map[string][]string{"become": {"doas"}, "become_user": {"postgres"}}))
+	assert.NoError(t, ValidateBecome(map[string][]string{"become": {"sudo"}, BecomePassOpt: {"secret"}}))
+
+	assert.ErrorContains(t, ValidateBecome(map[string][]string{"become": {"runas"}}), `invalid 'become' opt: "runas"`)
+	assert.ErrorContains(t, ValidateBecome(map[string][]string{"become_user": {"x; rm -rf /"}}), "invalid 'become_user' opt")
+	assert.ErrorContains(t, ValidateBecome(map[string][]string{"become": {"su"}, BecomePassOpt: {"secret"}}),
+		"only supported with become=sudo")
+	assert.Error(t, ValidateOpts(map[string][]string{"become": {"runas"}}))
+}
@@ -0,0 +1,91 @@
+package rconf
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// EnvOptPrefix starts the opts with the environment of the scripts: env.NAME=VALUE.
+// The variables are set on the command line (the server's AcceptEnv is not needed), after the escalation.
+const EnvOptPrefix = "env."
+
+// ArgsOpt holds the positional parameters of the scripts, one value per parameter.
+const ArgsOpt = "args"
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnvName checks the name of an environment variable
+func ValidateEnvName(name string) error {
+	if !envNameRe.MatchString(name) {
+		return fmt.Errorf("invalid environment variable name: %q", name)
+	}
+	return nil
+}
+
+// Env returns the environment of the opts as NAME=VALUE, sorted by name.
+func Env(opts map[string][]string) []string {
+	var env []string
+	for k := range opts {
+		if name, ok := strings.CutPrefix(k, EnvOptPrefix); ok {
+			env = append(env, name+"="+getOpt(opts, k))
+		}
+	}
+	slices.Sort(env)
+	return env
+}
+
+// ValidateEnv checks the names of the env.NAME opts.
+func ValidateEnv(opts map[string][]string) error {
+	for k := range opts {
+		if name, ok := strings.CutPrefix(k, EnvOptPrefix); ok {
+			if err := ValidateEnvName(name); err != nil {
+				return fmt.Errorf("invalid %q query-opt: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// envCommand returns the program (with its arguments) run with the environment of the opts: 'env NAME=VALUE program'
+func envCommand(program string, opts map[string][]string) string {
+	env := Env(opts)
+	if len(env) == 0 {
+		return program
+	}
+	return "env " + quoteAll(env) + " " + program
+}
+
+// exportCommand returns the shell command run with the environment of the opts: 'export NAME=VALUE; command'
+func exportCommand(command string, opts map[string][]string) string {
+	env := Env(opts)
+	if len(env) == 0 {
+		return command
+	}
+	return "export " + quoteAll(env) + "; " + command
+}
+
+// withArgs returns the program followed by the positional parameters of the opts
+func withArgs(program string, opts map[string][]string) string {
+	if len(opts[ArgsOpt]) == 0 {
+		return program
+	}
+	return program + " " + quoteAll(opts[ArgsOpt])
+}
+
+// setArgs returns the shell command run with the positional parameters of the opts: 'set -- ARGS; command'
+func setArgs(command string, opts map[string][]string) string {
+	if len(opts[ArgsOpt]) == 0 {
+		return command
+	}
+	return "set -- " + quoteAll(opts[ArgsOpt]) + "; " + command
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, ShellQuote(v))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,61 @@
+package rconf
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvCommands(t *testing.T) {
+	opts := map[string][]string{
+		"env.B":   {"it's"},
+		"env.A":   {"old", "1"},
+		"args":    {"--force", "two words"},
+		"sudo":    {"false"},
+		"unknown": {"x"},
+	}
+	assert.Equal(t, []string{"A=1", "B=it's"}, Env(opts))
+	assert.Equal(t, `chmod +x '/tmp/a.sh' && env 'A=1' 'B=it'\''s' '/tmp/a.sh' '--force' 'two words'`, ScriptCommand("/tmp/a.sh", opts))
+	assert.Equal(t, `export 'A=1' 'B=it'\''s'; set -- '--force' 'two words'; echo "$1"`, CommandLine(`echo "$1"`, opts))
+
+	// set after the escalation, sudo resets the environment
+	delete(opts, "sudo")
+	assert.Equal(t, `sudo chmod +x '/tmp/a.sh' && sudo env 'A=1' 'B=it'\''s' '/tmp/a.sh' '--force' 'two words'`, ScriptCommand("/tmp/a.sh", opts))
+	opts["interpreter"] = []string{"python3"}
+	assert.Equal(t, `sudo env 'A=1' 'B=it'\''s' python3 '/tmp/a.sh' '--force' 'two words'`, ScriptCommand("/tmp/a.sh", opts))
+	opts["become"] = []string{BecomeSu}
+	assert.Equal(t, `su root -c 'env '\''A=1'\'' '\''B=it'\''\'\'''\''s'\'' python3 '\''/tmp/a.sh'\'' '\''--force'\'' '\''two words'\'''`, ScriptCommand("/tmp/a.sh", opts))
+}
+
+func TestValidateEnv(t *testing.T) {
+	assert.NoError(t, ValidateOpts(map[string][]string{"env.APP_ENV": {"prod"}, "env._x1": {""}}))
+	for _, name := range []string{"env.", "env.1A", "env.A-B", "env.A B", "env.A;B"} {
+		assert.ErrorContains(t, ValidateOpts(map[string][]string{name: {"x"}}), "invalid environment variable name", name)
+	}
+}
+
+func TestExecuteScriptEnv(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	opts := map[string][]string{"sudo": {"false"}, "env.GREETING": {"hello 'world'"}, "args": {"a b", "$HOME"}}
+	script := filepath.Join(t.TempDir(), "env.sh")
+	require.NoError(t, client.UploadScript([]byte("#!/bin/sh\necho \"$GREETING|$#|$1|$2\"\n"), script))
+
+	out, err := client.ExecuteScript(context.Background(), script, opts, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello 'world'|2|a b|$HOME\n", out.Stdout)
+
+	out, err = client.ExecuteCommand(context.Background(), `echo "$GREETING|$#|$1|$2"`, opts, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello 'world'|2|a b|$HOME\n", out.Stdout)
+}
@@ -0,0 +1,201 @@
+package rconf
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key verification modes
+const (
+	HostKeyStrict    = "strict"
+	HostKeyAcceptNew = "accept-new"
+	HostKeyOff       = "off"
+)
+
+// knownHostsMu serializes access to known_hosts files, hosts are verified concurrently
+var knownHostsMu sync.Mutex
+
+// DefaultKnownHostsPath returns the path of the user's known_hosts file (~/.ssh/known_hosts).
+func DefaultKnownHostsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine known_hosts location: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// ValidateHostKeyCheck reports whether mode is a known host key verification mode.
+func ValidateHostKeyCheck(mode string) error {
+	switch mode {
+	case HostKeyStrict, HostKeyAcceptNew, HostKeyOff:
+		return nil
+	}
+	return fmt.Errorf("unknown host key check mode: %q (available: %s, %s, %s)",
+		mode, HostKeyStrict, HostKeyAcceptNew, HostKeyOff)
+}
+
+// hostKeyCallback returns a callback that verifies host keys against the known_hosts file.
+//
+// Hashed entries, @cert-authority and @revoked markers are handled by the knownhosts package.
+// In accept-new mode keys of unknown hosts are trusted on first use and appended to the file,
+// a changed key is always an error.
+func hostKeyCallback(mode, knownHostsPath string) (ssh.HostKeyCallback, error) {
+	if err := ValidateHostKeyCheck(mode); err != nil {
+		return nil, err
+	}
+	if mode == HostKeyOff {
+		//nolint:gosec
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+
+		err := checkKnownHosts(knownHostsPath, hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) > 0 {
+				return fmt.Errorf("host key mismatch for %s (%s): possible man-in-the-middle attack, known key at %s:%d",
+					hostname, ssh.FingerprintSHA256(key), keyErr.Want[0].Filename, keyErr.Want[0].Line)
+			}
+			if mode == HostKeyAcceptNew {
+				return appendKnownHost(knownHostsPath, hostname, key)
+			}
+			return fmt.Errorf("host key for %s (%s %s) is not in %s",
+				hostname, key.Type(), ssh.FingerprintSHA256(key), knownHostsPath)
+		}
+
+		var revokedErr *knownhosts.RevokedError
+		if errors.As(err, &revokedErr) {
+			return fmt.Errorf("host key for %s is revoked: %w", hostname, err)
+		}
+		return err
+	}, nil
+}
+
+// checkKnownHosts verifies the key against a fresh copy of the file, so that keys accepted by concurrent
+// connections are seen. A missing file is treated as an empty one.
+func checkKnownHosts(knownHostsPath, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if _, err := os.Stat(knownHostsPath); errors.Is(err, os.ErrNotExist) {
+		return &knownhosts.KeyError{}
+	}
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+	return callback(hostname, remote, key)
+}
+
+// appendKnownHost records a new host key in the known_hosts file.
+func appendKnownHost(knownHostsPath, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(knownHostsPath), 0o700); err != nil {
+		return fmt.Errorf("failed to create known_hosts directory: %w", err)
+	}
+	f, err := os.OpenFile(knownHostsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts: %w", err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	return nil
+}
+
+// certHostKeyAlgorithms are asked first for the hosts trusted through a @cert-authority entry: the key type
+// of the CA does not tell the type of the host key it signed, so every certificate type is accepted.
+var certHostKeyAlgorithms = []string{
+	ssh.CertAlgoED25519v01,
+	ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01,
+	ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01,
+}
+
+// knownHostKeyAlgorithms returns the host key algorithms already known for the address.
+//
+// The server is asked for these algorithms first, otherwise a host known by its ecdsa key
+// may present its ed25519 key, which would be reported as a mismatch. A host that matches a
+// @cert-authority entry is asked for its certificate first.
+func knownHostKeyAlgorithms(knownHostsPath, address string) []string {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	if _, err := os.Stat(knownHostsPath); err != nil {
+		return nil
+	}
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil
+	}
+	authorities, err := certAuthorityLines(knownHostsPath)
+	if err != nil {
+		return nil
+	}
+
+	// probe the database with a throwaway key: the error lists the keys that are known for the host
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+	remote := &net.TCPAddr{IP: net.IPv4zero}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(callback(address, remote, probe), &keyErr) {
+		return nil
+	}
+
+	// the CA keys are listed with the host keys, they are told apart by their line
+	var certs, algos []string
+	for _, known := range keyErr.Want {
+		switch {
+		case authorities[known.Line]:
+			certs = certHostKeyAlgorithms
+		case known.Key.Type() == ssh.KeyAlgoRSA:
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algos = append(algos, known.Key.Type())
+		}
+	}
+	return append(slices.Clone(certs), algos...)
+}
+
+// certAuthorityLines returns the numbers of the @cert-authority lines of the known_hosts file,
+// counted the way the knownhosts package does.
+func certAuthorityLines(knownHostsPath string) (map[int]bool, error) {
+	f, err := os.Open(knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := make(map[int]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.HasPrefix(strings.TrimSpace(scanner.Text()), "@cert-authority") {
+			lines[n] = true
+		}
+	}
+	return lines, scanner.Err()
+}
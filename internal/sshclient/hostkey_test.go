@@ -0,0 +1,174 @@
+package rconf
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer
+}
+
+func writeKnownHosts(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	content := ""
+	for _, l := range lines {
+		content += l + "\n"
+	}
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+var testRemote = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2222}
+
+func TestHostKeyCallbackStrict(t *testing.T) {
+	known := newTestSigner(t).PublicKey()
+	other := newTestSigner(t).PublicKey()
+	path := writeKnownHosts(t, knownhosts.Line([]string{"[db1]:2222"}, known))
+
+	cb, err := hostKeyCallback(HostKeyStrict, path)
+	require.NoError(t, err)
+
+	assert.NoError(t, cb("db1:2222", testRemote, known))
+	assert.ErrorContains(t, cb("db1:2222", testRemote, other), "mismatch")
+	assert.ErrorContains(t, cb("db2:2222", testRemote, known), "is not in")
+}
+
+func TestHostKeyCallbackStrictMissingFile(t *testing.T) {
+	key := newTestSigner(t).PublicKey()
+	cb, err := hostKeyCallback(HostKeyStrict, filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Error(t, cb("db1:22", testRemote, key))
+}
+
+func TestHostKeyCallbackAcceptNew(t *testing.T) {
+	key := newTestSigner(t).PublicKey()
+	other := newTestSigner(t).PublicKey()
+	path := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+
+	acceptNew, err := hostKeyCallback(HostKeyAcceptNew, path)
+	require.NoError(t, err)
+	strict, err := hostKeyCallback(HostKeyStrict, path)
+	require.NoError(t, err)
+
+	// first use: trusted and recorded
+	assert.NoError(t, acceptNew("db1:22", testRemote, key))
+	assert.NoError(t, strict("db1:22", testRemote, key))
+
+	// changed key is never accepted
+	assert.ErrorContains(t, acceptNew("db1:22", testRemote, other), "mismatch")
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, knownhosts.Line([]string{"db1"}, key)+"\n", string(content))
+}
+
+func TestHostKeyCallbackHashed(t *testing.T) {
+	key := newTestSigner(t).PublicKey()
+	path := writeKnownHosts(t, knownhosts.Line([]string{knownhosts.HashHostname("db1")}, key))
+
+	cb, err := hostKeyCallback(HostKeyStrict, path)
+	require.NoError(t, err)
+	assert.NoError(t, cb("db1:22", testRemote, key))
+	assert.Error(t, cb("db2:22", testRemote, key))
+}
+
+func TestHostKeyCallbackCertAuthority(t *testing.T) {
+	ca := newTestSigner(t)
+	hostKey := newTestSigner(t).PublicKey()
+	path := writeKnownHosts(t, "@cert-authority *.example.com "+string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+
+	cert := &ssh.Certificate{
+		Key:             hostKey,
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"db1.example.com"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+
+	cb, err := hostKeyCallback(HostKeyStrict, path)
+	require.NoError(t, err)
+	assert.NoError(t, cb("db1.example.com:22", testRemote, cert))
+	assert.Error(t, cb("db1.example.com:22", testRemote, hostKey))
+}
+
+func TestNewSSHClientCertAuthority(t *testing.T) {
+	ca := newTestSigner(t)
+	srv := newTestServer(t)
+	srv.password = "secret"
+	host, port, err := net.SplitHostPort(srv.addr())
+	require.NoError(t, err)
+
+	cert := &ssh.Certificate{
+		Key:             srv.hostKey.PublicKey(),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{host},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	certSigner, err := ssh.NewCertSigner(cert, srv.hostKey)
+	require.NoError(t, err)
+	srv.mu.Lock()
+	srv.hostCert = certSigner
+	srv.mu.Unlock()
+
+	// the host is trusted only through the CA: the server must present its certificate, not its plain key
+	path := writeKnownHosts(t, "@cert-authority ["+host+"]:"+port+" "+string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+	connInfo.Opts = map[string][]string{"hostkey": {HostKeyStrict}}
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{KnownHostsPath: path})
+	require.NoError(t, err)
+	client.Close()
+
+	// a host key of another CA is still rejected
+	path = writeKnownHosts(t, "@cert-authority ["+host+"]:"+port+" "+string(ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey())))
+	_, err = NewSSHClient(context.Background(), connInfo, &Options{KnownHostsPath: path})
+	assert.Error(t, err)
+}
+
+func TestHostKeyCallbackOff(t *testing.T) {
+	cb, err := hostKeyCallback(HostKeyOff, "")
+	require.NoError(t, err)
+	assert.NoError(t, cb("db1:22", testRemote, newTestSigner(t).PublicKey()))
+}
+
+func TestHostKeyCallbackUnknownMode(t *testing.T) {
+	_, err := hostKeyCallback("yes", "")
+	assert.Error(t, err)
+}
+
+func TestKnownHostKeyAlgorithms(t *testing.T) {
+	key := newTestSigner(t).PublicKey()
+	path := writeKnownHosts(t, knownhosts.Line([]string{"db1"}, key))
+
+	assert.Equal(t, []string{ssh.KeyAlgoED25519}, knownHostKeyAlgorithms(path, "db1:22"))
+	assert.Empty(t, knownHostKeyAlgorithms(path, "db2:22"))
+	assert.Empty(t, knownHostKeyAlgorithms(filepath.Join(t.TempDir(), "missing"), "db1:22"))
+
+	// a CA entry asks for the certificates first, whatever the key type of the CA
+	ca := newTestSigner(t).PublicKey()
+	path = writeKnownHosts(t,
+		"# hosts of the example.com domain",
+		"@cert-authority *.example.com "+string(ssh.MarshalAuthorizedKey(ca)),
+	)
+	assert.Equal(t, certHostKeyAlgorithms, knownHostKeyAlgorithms(path, "db1.example.com:22"))
+	assert.Empty(t, knownHostKeyAlgorithms(path, "db1:22"))
+}
@@ -0,0 +1,126 @@
+package rconf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// PingResult is the outcome of the connectivity checks of a host.
+type PingResult struct {
+	Reachable bool          // the TCP connection was established
+	HostKey   string        // known, added, not verified, rejected (empty when the host was not reached)
+	Auth      string        // the accepted auth method: publickey, publickey (ssh-agent), password
+	SFTP      bool          // the sftp subsystem is available
+	Sudo      bool          // sudo works without a password, or with the become_pass opt when set
+	Latency   time.Duration // round trip of an SSH request
+	OS        string        // PRETTY_NAME from /etc/os-release
+	Err       error         // the failure that stopped the checks: dial, host key or auth
+}
+
+// Ping connects to the host like NewSSHClient (through its jump hosts) and checks what scripts need:
+// SFTP and sudo, without a password unless the become_pass opt is set. A missing SFTP or sudo is not an error.
+func Ping(ctx context.Context, connInfo connstr.ConnInfo, opts *Options) *PingResult {
+	result := &PingResult{}
+
+	bastions := opts.Bastions
+	if bastions == nil {
+		bastions = NewBastionPool()
+	}
+	via, jumpKeys, err := bastions.acquireChain(ctx, connInfo.Jumps, opts)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer bastions.releaseChain(jumpKeys)
+
+	trace := &dialTrace{}
+	client, err := dialSSH(ctx, via, &connInfo, opts, trace)
+	result.Reachable = trace.reachable
+	result.HostKey = trace.hostKey
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer client.Close()
+	result.Auth = trace.auth
+
+	start := time.Now()
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+		result.Latency = time.Since(start)
+	}
+
+	if sftpClient, err := sftp.NewClient(client); err == nil {
+		result.SFTP = true
+		sftpClient.Close()
+	}
+
+	s := &SSHClient{client: client}
+	sudoCheck, input := "sudo -n true", ""
+	if pass := getOpt(connInfo.Opts, BecomePassOpt); pass != "" {
+		// the password is written to the stdin of 'sudo -S', like for the scripts
+		sudoCheck, input = sudoWithPassword("true", ""), pass+"\n"
+	}
+	if _, err := s.run(ctx, sudoCheck, input, nil); err == nil {
+		result.Sudo = true
+	}
+	if out, err := s.run(ctx, "cat /etc/os-release", "", nil); err == nil {
+		result.OS = parseOSRelease(out.Stdout)
+	}
+	return result
+}
+
+// parseOSRelease returns PRETTY_NAME (or NAME VERSION_ID) of an os-release file
+func parseOSRelease(content string) string {
+	values := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(v); err == nil {
+			v = unquoted
+		} else {
+			v = strings.Trim(v, `'"`)
+		}
+		values[k] = v
+	}
+	if values["PRETTY_NAME"] != "" {
+		return values["PRETTY_NAME"]
+	}
+	return strings.TrimSpace(values["NAME"] + " " + values["VERSION_ID"])
+}
+
+// traceHostKey records the outcome of the host key verification in the trace
+func traceHostKey(callback ssh.HostKeyCallback, mode, knownHostsPath string, trace *dialTrace) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if mode == HostKeyOff {
+			trace.hostKey = HostKeyStatusNotVerified
+			return callback(hostname, remote, key)
+		}
+
+		knownHostsMu.Lock()
+		known := checkKnownHosts(knownHostsPath, hostname, remote, key)
+		knownHostsMu.Unlock()
+
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		switch {
+		case err != nil:
+			trace.hostKey = HostKeyStatusRejected
+		case errors.As(known, &keyErr):
+			trace.hostKey = HostKeyStatusAdded
+		default:
+			trace.hostKey = HostKeyStatusKnown
+		}
+		return err
+	}
+}
@@ -0,0 +1,128 @@
+package rconf
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPing(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	result := Ping(context.Background(), connInfo, &Options{})
+
+	require.NoError(t, result.Err)
+	assert.True(t, result.Reachable)
+	assert.Equal(t, HostKeyStatusNotVerified, result.HostKey)
+	assert.Equal(t, "password", result.Auth)
+	assert.True(t, result.SFTP)
+	assert.Positive(t, result.Latency)
+	assert.Contains(t, srv.commands, "sudo -n true")
+}
+
+func TestPingBecomePass(t *testing.T) {
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "sudo"), []byte(fakeSudo), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	srv := newTestServer(t)
+	srv.password = "ssh-secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	// sudo is checked with the password, which never goes to the command line
+	connInfo.Opts = map[string][]string{"hostkey": {HostKeyOff}, BecomePassOpt: {"secret"}}
+	result := Ping(context.Background(), connInfo, &Options{})
+	require.NoError(t, result.Err)
+	assert.True(t, result.Sudo)
+
+	connInfo.Opts = map[string][]string{"hostkey": {HostKeyOff}, BecomePassOpt: {"wrong"}}
+	result = Ping(context.Background(), connInfo, &Options{})
+	require.NoError(t, result.Err)
+	assert.False(t, result.Sudo)
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Contains(t, srv.commands, "sudo -k -S -p '' sh -c 'exec </dev/null; true'")
+	for _, c := range srv.commands {
+		assert.NotContains(t, c, "secret")
+		assert.NotContains(t, c, "wrong")
+	}
+}
+
+func TestPingHostKey(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+	connInfo.Opts = map[string][]string{"hostkey": {HostKeyAcceptNew}}
+	opts := &Options{KnownHostsPath: filepath.Join(t.TempDir(), "known_hosts")}
+
+	// first use: recorded, then known
+	result := Ping(context.Background(), connInfo, opts)
+	require.NoError(t, result.Err)
+	assert.Equal(t, HostKeyStatusAdded, result.HostKey)
+
+	result = Ping(context.Background(), connInfo, opts)
+	require.NoError(t, result.Err)
+	assert.Equal(t, HostKeyStatusKnown, result.HostKey)
+
+	// unknown hosts are rejected in strict mode
+	other := newTestServer(t)
+	otherInfo := other.connInfo()
+	otherInfo.Password = "secret"
+	otherInfo.Opts = map[string][]string{"hostkey": {HostKeyStrict}}
+	result = Ping(context.Background(), otherInfo, opts)
+	assert.Error(t, result.Err)
+	assert.True(t, result.Reachable)
+	assert.Equal(t, HostKeyStatusRejected, result.HostKey)
+	assert.Empty(t, result.Auth)
+}
+
+func TestPingFailures(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = "wrong"
+
+	result := Ping(context.Background(), connInfo, &Options{})
+	assert.ErrorContains(t, result.Err, "unable to authenticate")
+	assert.True(t, result.Reachable)
+	assert.Equal(t, HostKeyStatusNotVerified, result.HostKey)
+	assert.False(t, result.SFTP)
+
+	// nothing listens on the port anymore
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+	connInfo.Port = port
+
+	result = Ping(context.Background(), connInfo, &Options{})
+	assert.ErrorContains(t, result.Err, "failed to dial SSH")
+	assert.False(t, result.Reachable)
+	assert.Empty(t, result.HostKey)
+}
+
+func TestParseOSRelease(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"NAME=\"Ubuntu\"\nVERSION_ID=\"22.04\"\nPRETTY_NAME=\"Ubuntu 22.04.4 LTS\"\n", "Ubuntu 22.04.4 LTS"},
+		{"NAME='Alpine Linux'\nVERSION_ID=3.19.1\n", "Alpine Linux 3.19.1"},
+		{"# comment\nID=debian\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseOSRelease(tt.content))
+	}
+}
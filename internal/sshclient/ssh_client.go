@@ -1,53 +1,255 @@
 package rconf
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashmap-kz/rconf/internal/connstr"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
+// signalGracePeriod is the time given to a remote process to exit after SIGTERM
+var signalGracePeriod = 5 * time.Second
+
 // SSHClient wraps an SSH client and SFTP session.
 type SSHClient struct {
 	client *ssh.Client
 	sftp   *sftp.Client
+
+	// jump hosts in use, released on Close
+	bastions *BastionPool
+	jumpKeys []string
+}
+
+// Options holds the client settings shared by all hosts.
+type Options struct {
+	PrivateKeyPath       string
+	PrivateKeyPassphrase string
+	KnownHostsPath       string       // default: ~/.ssh/known_hosts
+	HostKeyCheck         string       // strict (default), accept-new, off; overridden per host by the 'hostkey' query-opt
+	UseAgent             bool         // use keys from SSH_AUTH_SOCK; overridden per host by the 'agent' query-opt
+	NoSFTP               bool         // commands only: the SFTP session is not opened, UploadScript fails
+	Bastions             *BastionPool // shares jump host connections between hosts, optional
 }
 
 // NewSSHClient establishes an SSH and SFTP connection.
-func NewSSHClient(connInfoPass connstr.ConnInfo, pkeyPath, pkeyPass string) (*SSHClient, error) {
-	authMethods, err := getAuthsMethods(connInfoPass.Password, pkeyPath, pkeyPass)
-	if err != nil {
-		return nil, err
+// When the host is behind jump hosts, each hop is connected in turn (with its own auth and host key check)
+// and the target is reached through the last one.
+//
+// The context bounds the connection attempt, it is not used after NewSSHClient returns.
+func NewSSHClient(ctx context.Context, connInfoPass connstr.ConnInfo, opts *Options) (*SSHClient, error) {
+	bastions := opts.Bastions
+	if bastions == nil {
+		bastions = NewBastionPool()
 	}
 
-	config := &ssh.ClientConfig{
-		User: connInfoPass.User,
-		Auth: authMethods,
-		//nolint:gosec
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	via, jumpKeys, err := bastions.acquireChain(ctx, connInfoPass.Jumps, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%s", connInfoPass.Host, connInfoPass.Port), config)
+	client, err := dialSSH(ctx, via, &connInfoPass, opts, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial SSH: %w", err)
+		bastions.releaseChain(jumpKeys)
+		return nil, err
 	}
 
+	if opts.NoSFTP {
+		return &SSHClient{client: client, bastions: bastions, jumpKeys: jumpKeys}, nil
+	}
 	sftpClient, err := sftp.NewClient(client)
 	if err != nil {
 		client.Close()
+		bastions.releaseChain(jumpKeys)
 		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
 	}
 
-	return &SSHClient{client: client, sftp: sftpClient}, nil
+	return &SSHClient{client: client, sftp: sftpClient, bastions: bastions, jumpKeys: jumpKeys}, nil
+}
+
+// dialTrace records the steps of a connection, for Ping.
+type dialTrace struct {
+	reachable bool   // the TCP connection was established
+	hostKey   string // one of the HostKeyStatus* values
+	auth      string // the last auth method tried: the accepted one when the connection succeeds
+}
+
+// Host key statuses reported by Ping
+const (
+	HostKeyStatusKnown       = "known"
+	HostKeyStatusAdded       = "added"
+	HostKeyStatusNotVerified = "not verified"
+	HostKeyStatusRejected    = "rejected"
+)
+
+// dialSSH connects and authenticates to the host, directly or through the 'via' client.
+// The trace is optional.
+func dialSSH(ctx context.Context, via *ssh.Client, connInfoPass *connstr.ConnInfo, opts *Options, trace *dialTrace) (*ssh.Client, error) {
+	var err error
+
+	useAgent := opts.UseAgent
+	if v := getOpt(connInfoPass.Opts, "agent"); v != "" {
+		useAgent, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'agent' query-opt: %q", v)
+		}
+	}
+	var agentClient agent.Agent
+	if useAgent {
+		var agentConn net.Conn
+		agentClient, agentConn, err = dialAgent()
+		if err != nil {
+			return nil, err
+		}
+		// keys are only requested during the handshake
+		defer agentConn.Close()
+	}
+
+	// the keys are offered in order: the 'key' query-opt, --pkey, then the ssh_config identities
+	pkeyPaths := slices.Clone(connInfoPass.Opts["key"])
+	if strings.TrimSpace(opts.PrivateKeyPath) != "" && !slices.Contains(pkeyPaths, opts.PrivateKeyPath) {
+		pkeyPaths = append(pkeyPaths, opts.PrivateKeyPath)
+	}
+
+	identityFiles := connInfoPass.IdentityFiles
+	if len(pkeyPaths) == 0 && len(identityFiles) == 0 {
+		identityFiles = defaultIdentityFiles()
+	}
+
+	var attempt func(method string)
+	if trace != nil {
+		attempt = func(method string) { trace.auth = method }
+	}
+	authMethods, err := getAuthsMethods(connInfoPass.Password, pkeyPaths, identityFiles, opts.PrivateKeyPassphrase, agentClient, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	knownHostsPath := opts.KnownHostsPath
+	if knownHostsPath == "" {
+		knownHostsPath, err = DefaultKnownHostsPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	hostKeyCheck := opts.HostKeyCheck
+	if v := getOpt(connInfoPass.Opts, "hostkey"); v != "" {
+		hostKeyCheck = v
+	}
+	if hostKeyCheck == "" {
+		hostKeyCheck = HostKeyStrict
+	}
+	hostKeyCallback, err := hostKeyCallback(hostKeyCheck, knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+	if trace != nil {
+		hostKeyCallback = traceHostKey(hostKeyCallback, hostKeyCheck, knownHostsPath, trace)
+	}
+
+	addr := net.JoinHostPort(connInfoPass.Host, connInfoPass.Port)
+	config := &ssh.ClientConfig{
+		User:            connInfoPass.User,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+	}
+	if hostKeyCheck != HostKeyOff {
+		config.HostKeyAlgorithms = knownHostKeyAlgorithms(knownHostsPath, addr)
+	}
+
+	var conn net.Conn
+	if via == nil {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial SSH: %w", err)
+		}
+	} else {
+		conn, err = via.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial %s through jump host: %w", addr, err)
+		}
+	}
+	if trace != nil {
+		trace.reachable = true
+	}
+
+	// the handshake is not context-aware: the connection is closed when the context is done
+	handshakeDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshakeDone:
+		}
+	}()
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	close(handshakeDone)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to dial SSH: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to dial SSH: %w", err)
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
 }
 
-// Close closes SSH and SFTP connections.
+// ValidateOpts checks the values of the query-opts used when connecting to a host.
+func ValidateOpts(opts map[string][]string) error {
+	for _, v := range opts["hostkey"] {
+		if err := ValidateHostKeyCheck(v); err != nil {
+			return err
+		}
+	}
+	for _, v := range opts["agent"] {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid 'agent' query-opt: %q", v)
+		}
+	}
+	if err := ValidateEnv(opts); err != nil {
+		return err
+	}
+	return ValidateBecome(opts)
+}
+
+// Close closes SSH and SFTP connections, and releases the jump hosts.
 func (s *SSHClient) Close() {
-	s.sftp.Close()
+	if s.sftp != nil {
+		s.sftp.Close()
+	}
 	s.client.Close()
+	s.bastions.releaseChain(s.jumpKeys)
+}
+
+// defaultIdentityFiles returns the default identities of ssh that exist (~/.ssh/id_rsa, id_ecdsa, id_ed25519),
+// they are tried when neither the connection nor the ssh config names a key.
+func defaultIdentityFiles() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, name := range []string{"id_rsa", "id_ecdsa", "id_ed25519"} {
+		f := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+	return files
 }
 
 func isPasswordProtectedPrivateKey(key []byte) bool {
@@ -72,38 +274,93 @@ func getSigner(key []byte, passphrase string) (ssh.Signer, error) {
 	return signer, err
 }
 
-// getAuthsMethods collects authentication with password or private_key+optional(passphrase)
-func getAuthsMethods(password, pkeyPath, pkeyPass string) ([]ssh.AuthMethod, error) {
+// getAuthsMethods collects authentication with private_key+optional(passphrase), ssh-agent and password.
+// Public keys are offered first (private key files, identity files, then agent keys), password is the fallback.
+// The private key files must load; like ssh, the identity files (from ssh_config) that cannot be loaded
+// (e.g. protected by another passphrase) are skipped.
+// The optional attempt callback receives the name of each method when the client tries it.
+func getAuthsMethods(password string, pkeyPaths, identityFiles []string, pkeyPass string, agentClient agent.Agent, attempt func(method string)) ([]ssh.AuthMethod, error) {
 	var auths []ssh.AuthMethod
+	note := func(method string) {
+		if attempt != nil {
+			attempt(method)
+		}
+	}
 
-	// should be password or private-key
-	if strings.TrimSpace(password) == "" && strings.TrimSpace(pkeyPath) == "" {
-		return nil, fmt.Errorf("both password and private-key-path are empty")
+	// should be password, private-key or agent
+	if strings.TrimSpace(password) == "" && len(pkeyPaths) == 0 && len(identityFiles) == 0 && agentClient == nil {
+		return nil, fmt.Errorf("no auth methods: password, private-key-path and ssh-agent are empty")
 	}
 
-	// password-based-auth
+	// pkey-based-auth
 
-	if password != "" {
-		auths = append(auths, ssh.Password(password))
-		return auths, nil
+	var signers []ssh.Signer
+	for _, pkeyPath := range pkeyPaths {
+		key, err := os.ReadFile(pkeyPath)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := getSigner(key, pkeyPass)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	for _, f := range identityFiles {
+		if slices.Contains(pkeyPaths, f) {
+			continue
+		}
+		key, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		signer, err := getSigner(key, pkeyPass)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
 	}
 
-	// pkey-based-auth
+	// agent-based-auth (the server tries the 'publickey' method once, so all keys are offered together)
 
-	key, err := os.ReadFile(pkeyPath)
-	if err != nil {
-		return nil, err
+	if agentClient != nil {
+		auths = append(auths, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			note("publickey (ssh-agent)")
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get ssh-agent keys: %w", err)
+			}
+			return append(signers, agentSigners...), nil
+		}))
+	} else if len(signers) > 0 {
+		auths = append(auths, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			note("publickey")
+			return signers, nil
+		}))
 	}
-	signer, err := getSigner(key, pkeyPass)
-	if err != nil {
-		return nil, err
+
+	// password-based-auth
+
+	if password != "" {
+		auths = append(auths, ssh.PasswordCallback(func() (string, error) {
+			note("password")
+			return password, nil
+		}))
+	}
+	if len(auths) == 0 {
+		return nil, fmt.Errorf("no auth methods: none of the identity files could be loaded (%s)", strings.Join(identityFiles, ", "))
 	}
-	auths = append(auths, ssh.PublicKeys(signer))
 	return auths, nil
 }
 
 // UploadScript uploads a script to the remote host from memory.
 func (s *SSHClient) UploadScript(scriptContent []byte, remotePath string) error {
+	if s.sftp == nil {
+		return errors.New("SFTP session is not opened")
+	}
+	if err := s.sftp.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
 	dstFile, err := s.sftp.Create(remotePath)
 	if err != nil {
 		return fmt.Errorf("failed to create remote script: %w", err)
@@ -118,25 +375,184 @@ func (s *SSHClient) UploadScript(scriptContent []byte, remotePath string) error
 	return nil
 }
 
+// CreateDir creates a directory with the mode (e.g. 0700: only the login user can access it), it must not exist yet.
+func (s *SSHClient) CreateDir(remotePath string, mode os.FileMode) error {
+	if s.sftp == nil {
+		return errors.New("SFTP session is not opened")
+	}
+	if err := s.sftp.Mkdir(remotePath); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+	if err := s.sftp.Chmod(remotePath, mode); err != nil {
+		return fmt.Errorf("failed to set remote directory mode: %w", err)
+	}
+	return nil
+}
+
+// RemoveDir removes the directory and its content.
+func (s *SSHClient) RemoveDir(remotePath string) error {
+	if s.sftp == nil {
+		return errors.New("SFTP session is not opened")
+	}
+	if err := s.sftp.RemoveAll(remotePath); err != nil {
+		return fmt.Errorf("failed to remove remote directory: %w", err)
+	}
+	return nil
+}
+
+// ExecResult holds the output captured from a remote command.
+type ExecResult struct {
+	Stdout string
+	Stderr string
+}
+
+// Stream receives a copy of the remote output while the script runs, nil writers are ignored.
+type Stream struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
 // ExecuteScript executes a script on the remote host.
-func (s *SSHClient) ExecuteScript(remotePath string, opts map[string][]string) (string, error) {
+// The result holds the output captured so far, also when an error is returned.
+// The output is also copied to the stream as it arrives (when the stream is not nil).
+//
+// When the context is done before the script exits, the remote process gets SIGTERM,
+// the session is closed and the context error is returned (wrapped).
+func (s *SSHClient) ExecuteScript(ctx context.Context, remotePath string, opts map[string][]string, stream *Stream) (*ExecResult, error) {
+	result, err := s.run(ctx, ScriptCommand(remotePath, opts), becomeInput(opts), stream)
+	if err != nil {
+		return result, fmt.Errorf("failed to execute script: %w", err)
+	}
+	return result, nil
+}
+
+// ExecuteCommand runs an ad-hoc command on the remote host (with sudo unless sudo=false), like ExecuteScript.
+func (s *SSHClient) ExecuteCommand(ctx context.Context, command string, opts map[string][]string, stream *Stream) (*ExecResult, error) {
+	result, err := s.run(ctx, CommandLine(command, opts), becomeInput(opts), stream)
+	if err != nil {
+		return result, fmt.Errorf("failed to execute command: %w", err)
+	}
+	return result, nil
+}
+
+// CommandLine returns the command line that runs an ad-hoc command with the escalation method of the opts:
+// 'sudo sh -c <command>' by default, the command as-is with become=none (or sudo=false).
+// The environment and the positional parameters of the opts are set before the command.
+func CommandLine(command string, opts map[string][]string) string {
+	return becomeCommand(exportCommand(setArgs(command, opts), opts), opts)
+}
+
+// BecomePassOpt is the opt with the sudo password, it is written to the stdin of 'sudo -S', never to the command line.
+const BecomePassOpt = "become_pass"
+
+// ShellQuote wraps the value in single quotes for the shell, embedded single quotes are escaped.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ScriptCommand returns the command line that runs the uploaded script with the escalation method of the opts
+// (sudo by default), with the interpreter opt when set, and with the environment and the positional parameters of the opts.
+func ScriptCommand(remotePath string, opts map[string][]string) string {
+	// the remote path keeps the local directories of the script, which may hold spaces and quotes
+	remotePath = ShellQuote(remotePath)
+	run, chmod := remotePath, fmt.Sprintf("chmod +x %s && ", remotePath)
+	if interpreter := getOpt(opts, "interpreter"); interpreter != "" {
+		run, chmod = fmt.Sprintf("%s %s", interpreter, remotePath), ""
+	}
+	run = envCommand(withArgs(run, opts), opts)
+	switch {
+	case BecomeMethod(opts) == BecomeNone:
+		return chmod + run
+	case BecomeUser(opts) != "":
+		// the login user owns the script
+		return chmod + becomeCommand(run, opts)
+	case BecomeMethod(opts) == BecomeSudo && getOpt(opts, BecomePassOpt) == "":
+		if chmod == "" {
+			return "sudo " + run
+		}
+		return fmt.Sprintf("sudo chmod +x %s && sudo %s", remotePath, run)
+	}
+	return becomeCommand(chmod+run, opts)
+}
+
+// RunCommand runs a command on the remote host (as the login user) and captures its output.
+func (s *SSHClient) RunCommand(ctx context.Context, cmd string) (*ExecResult, error) {
+	result, err := s.run(ctx, cmd, "", nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to run command: %w", err)
+	}
+	return result, nil
+}
+
+// run runs the command in a new session with the stdin, the result holds the output captured so far
+func (s *SSHClient) run(ctx context.Context, cmd, stdin string, stream *Stream) (*ExecResult, error) {
+	result := &ExecResult{}
+
 	session, err := s.client.NewSession()
 	if err != nil {
-		return "", fmt.Errorf("failed to create SSH session: %w", err)
+		return result, fmt.Errorf("failed to create SSH session: %w", err)
 	}
 	defer session.Close()
 
-	cmd := fmt.Sprintf("sudo chmod +x %s && sudo %s", remotePath, remotePath)
-	if hasOpt(opts, "sudo", "false") {
-		cmd = fmt.Sprintf("chmod +x %s && %s", remotePath, remotePath)
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if stdin != "" {
+		session.Stdin = strings.NewReader(stdin)
+	}
+	if stream != nil && stream.Stdout != nil {
+		session.Stdout = io.MultiWriter(&stdout, stream.Stdout)
+	}
+	if stream != nil && stream.Stderr != nil {
+		session.Stderr = io.MultiWriter(&stderr, stream.Stderr)
 	}
 
-	out, err := session.CombinedOutput(cmd)
-	if err != nil {
-		return string(out), fmt.Errorf("failed to execute script: %w", err)
+	err = runSession(ctx, session, cmd)
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	return result, err
+}
+
+// runSession runs the command, and stops it when the context is done.
+func runSession(ctx context.Context, session *ssh.Session, cmd string) error {
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
 	}
 
-	return string(out), nil
+	// not every server honors signals, the session is closed after the grace period anyway
+	_ = session.Signal(ssh.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(signalGracePeriod):
+		// closing the channel ends Wait, the output copied so far stays in the buffers
+		session.Close()
+		<-done
+	}
+	return ctx.Err()
+}
+
+// ExitStatus returns the remote exit status carried by the error of ExecuteScript, or -1
+// when the script did not run to completion (e.g. the session failed).
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return -1
 }
 
 // internal
@@ -151,3 +567,10 @@ func hasOpt(opts map[string][]string, k, v string) bool {
 	}
 	return false
 }
+
+func getOpt(opts map[string][]string, k string) string {
+	if val, exists := opts[k]; exists && len(val) > 0 {
+		return val[len(val)-1]
+	}
+	return ""
+}
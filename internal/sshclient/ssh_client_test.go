@@ -1,9 +1,23 @@
 package rconf
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 func TestHasOpt(t *testing.T) {
@@ -66,3 +80,465 @@ func TestHasOpt(t *testing.T) {
 		})
 	}
 }
+
+// startTestAgent serves an in-memory ssh-agent holding the given keys and points SSH_AUTH_SOCK to it.
+func startTestAgent(t *testing.T, keys ...ed25519.PrivateKey) {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	for _, k := range keys {
+		require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: k}))
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+}
+
+func newTestKey(t *testing.T) (ed25519.PrivateKey, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return priv, sshPub
+}
+
+func TestGetAuthsMethods(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	priv, _ := newTestKey(t)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600))
+
+	protectedPath := filepath.Join(t.TempDir(), "id_protected")
+	block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("other"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(protectedPath, pem.EncodeToMemory(block), 0o600))
+
+	tests := []struct {
+		name       string
+		password   string
+		pkeyPath   []string
+		identities []string
+		agent      agent.Agent
+		want       int
+		wantErr    bool
+	}{
+		{name: "Nothing configured", wantErr: true},
+		{name: "Password only", password: "secret", want: 1},
+		{name: "Private key only", pkeyPath: []string{keyPath}, want: 1},
+		{name: "Agent only", agent: agent.NewKeyring(), want: 1},
+		{name: "Private key and password", pkeyPath: []string{keyPath}, password: "secret", want: 2},
+		{name: "Agent, private key and password", agent: agent.NewKeyring(), pkeyPath: []string{keyPath}, password: "secret", want: 2},
+		{name: "Missing private key", pkeyPath: []string{filepath.Join(t.TempDir(), "missing")}, wantErr: true},
+		{name: "Protected private key", pkeyPath: []string{protectedPath}, wantErr: true},
+		{name: "Identity file only", identities: []string{keyPath}, want: 1},
+		{name: "Protected identity file skipped", identities: []string{protectedPath}, agent: agent.NewKeyring(), want: 1},
+		{name: "Protected identity file skipped, password", identities: []string{protectedPath}, password: "secret", want: 1},
+		{name: "No identity file loaded", identities: []string{protectedPath}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auths, err := getAuthsMethods(tt.password, tt.pkeyPath, tt.identities, "", tt.agent, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, auths, tt.want)
+		})
+	}
+}
+
+// writeTestKey writes a new private key (protected when the passphrase is set) and returns its path and public key
+func writeTestKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	priv, pub := newTestKey(t)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+	return path, pub
+}
+
+func TestNewSSHClientKeyPrecedence(t *testing.T) {
+	optKey, optPub := writeTestKey(t, "")
+	pkey, pkeyPub := writeTestKey(t, "")
+	configKey, configPub := writeTestKey(t, "")
+	protectedKey, _ := writeTestKey(t, "other")
+
+	tests := []struct {
+		name       string
+		authorized ssh.PublicKey
+		withOpt    bool
+		want       []ssh.PublicKey
+	}{
+		{name: "--pkey before IdentityFile", authorized: pkeyPub, want: []ssh.PublicKey{pkeyPub}},
+		{name: "IdentityFile after --pkey", authorized: configPub, want: []ssh.PublicKey{pkeyPub, configPub}},
+		{name: "key opt before --pkey", authorized: pkeyPub, withOpt: true, want: []ssh.PublicKey{optPub, pkeyPub}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			srv.keys = []ssh.PublicKey{tt.authorized}
+			connInfo := srv.connInfo()
+			// a protected identity file is skipped, not fatal
+			connInfo.IdentityFiles = []string{protectedKey, configKey}
+			if tt.withOpt {
+				connInfo.Opts["key"] = []string{optKey}
+			}
+
+			client, err := NewSSHClient(context.Background(), connInfo, &Options{PrivateKeyPath: pkey})
+			require.NoError(t, err)
+			client.Close()
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			assert.Equal(t, tt.want, srv.offered)
+		})
+	}
+}
+
+func TestNewSSHClientDefaultIdentities(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	require.NoError(t, os.Mkdir(filepath.Join(home, ".ssh"), 0o700))
+	defaultKey, defaultPub := writeTestKey(t, "")
+	require.NoError(t, os.Rename(defaultKey, filepath.Join(home, ".ssh", "id_ed25519")))
+	// like ssh, a protected default identity is skipped
+	protectedKey, _ := writeTestKey(t, "other")
+	require.NoError(t, os.Rename(protectedKey, filepath.Join(home, ".ssh", "id_rsa")))
+	pkey, pkeyPub := writeTestKey(t, "")
+
+	srv := newTestServer(t)
+	srv.keys = []ssh.PublicKey{defaultPub, pkeyPub}
+
+	// no key is configured: the default identities are tried
+	client, err := NewSSHClient(context.Background(), srv.connInfo(), &Options{})
+	require.NoError(t, err)
+	client.Close()
+
+	// a configured key replaces the default identities
+	client, err = NewSSHClient(context.Background(), srv.connInfo(), &Options{PrivateKeyPath: pkey})
+	require.NoError(t, err)
+	client.Close()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Equal(t, []ssh.PublicKey{defaultPub, pkeyPub}, srv.offered)
+}
+
+func TestNewSSHClientAgentAuth(t *testing.T) {
+	priv, pub := newTestKey(t)
+	startTestAgent(t, priv)
+
+	srv := newTestServer(t)
+	srv.keys = []ssh.PublicKey{pub}
+
+	// agent enabled globally
+	client, err := NewSSHClient(context.Background(), srv.connInfo(), &Options{UseAgent: true})
+	require.NoError(t, err)
+	client.Close()
+
+	// agent disabled per host, nothing else to authenticate with
+	connInfo := srv.connInfo()
+	connInfo.Opts["agent"] = []string{"false"}
+	_, err = NewSSHClient(context.Background(), connInfo, &Options{UseAgent: true})
+	assert.Error(t, err)
+
+	// agent enabled per host, alongside a password that the server rejects
+	connInfo = srv.connInfo()
+	connInfo.Password = "wrong"
+	connInfo.Opts["agent"] = []string{"true"}
+	client, err = NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	client.Close()
+}
+
+func TestNewSSHClientAgentMissingSocket(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	srv := newTestServer(t)
+	_, err := NewSSHClient(context.Background(), srv.connInfo(), &Options{UseAgent: true})
+	assert.ErrorContains(t, err, "SSH_AUTH_SOCK")
+}
+
+func TestValidateOpts(t *testing.T) {
+	assert.NoError(t, ValidateOpts(map[string][]string{"hostkey": {"accept-new"}, "agent": {"true"}}))
+	assert.Error(t, ValidateOpts(map[string][]string{"hostkey": {"yes"}}))
+	assert.Error(t, ValidateOpts(map[string][]string{"agent": {"maybe"}}))
+}
+
+func TestExecuteScriptExitStatus(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	opts := map[string][]string{"sudo": {"false"}}
+	dir := t.TempDir()
+
+	okScript := filepath.Join(dir, "ok.sh")
+	require.NoError(t, client.UploadScript([]byte("#!/bin/sh\necho ok\necho warn >&2\n"), okScript))
+	var streamOut, streamErr bytes.Buffer
+	out, err := client.ExecuteScript(context.Background(), okScript, opts, &Stream{Stdout: &streamOut, Stderr: &streamErr})
+	assert.NoError(t, err)
+	assert.Equal(t, &ExecResult{Stdout: "ok\n", Stderr: "warn\n"}, out)
+	assert.Equal(t, "ok\n", streamOut.String())
+	assert.Equal(t, "warn\n", streamErr.String())
+	assert.Equal(t, 0, ExitStatus(err))
+
+	failScript := filepath.Join(dir, "fail.sh")
+	require.NoError(t, client.UploadScript([]byte("#!/bin/sh\necho failing >&2\nexit 3\n"), failScript))
+	out, err = client.ExecuteScript(context.Background(), failScript, opts, nil)
+	assert.Error(t, err)
+	assert.Equal(t, "failing\n", out.Stderr)
+	assert.Equal(t, 3, ExitStatus(err))
+
+	assert.Equal(t, -1, ExitStatus(errors.New("session failed")))
+}
+
+func TestExecuteScriptQuotedPath(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// the remote path keeps the local directories of the script
+	dir := filepath.Join(t.TempDir(), "my dir", "it's")
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	script := filepath.Join(dir, "a b.sh")
+	require.NoError(t, client.UploadScript([]byte("#!/bin/sh\necho ok\n"), script))
+
+	for _, opts := range []map[string][]string{
+		{"sudo": {"false"}},
+		{"sudo": {"false"}, "interpreter": {"sh"}},
+		{"sudo": {"false"}, ArgsOpt: {"--force"}},
+	} {
+		out, err := client.ExecuteScript(context.Background(), script, opts, nil)
+		require.NoError(t, err, opts)
+		assert.Equal(t, "ok\n", out.Stdout)
+	}
+
+	assert.Equal(t, `chmod +x '/tmp/my dir/it'\''s.sh' && '/tmp/my dir/it'\''s.sh'`,
+		ScriptCommand("/tmp/my dir/it's.sh", map[string][]string{"sudo": {"false"}}))
+	assert.Equal(t, `sudo chmod +x '/tmp/my dir/it'\''s.sh' && sudo '/tmp/my dir/it'\''s.sh'`,
+		ScriptCommand("/tmp/my dir/it's.sh", nil))
+	assert.Equal(t, `sudo python3 '/tmp/my dir/it'\''s.sh'`,
+		ScriptCommand("/tmp/my dir/it's.sh", map[string][]string{"interpreter": {"python3"}}))
+}
+
+func TestRemoteDir(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	dir := filepath.Join(t.TempDir(), "rconf-run")
+	require.NoError(t, client.CreateDir(dir, 0o700))
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+	assert.ErrorContains(t, client.CreateDir(dir, 0o700), "failed to create remote directory")
+
+	// the parent directories of the scripts are created
+	script := filepath.Join(dir, "db", "01-init.sh")
+	require.NoError(t, client.UploadScript([]byte("echo"), script))
+	assert.FileExists(t, script)
+
+	require.NoError(t, client.RemoveDir(dir))
+	assert.NoDirExists(t, dir)
+}
+
+func TestScriptCommand(t *testing.T) {
+	tests := []struct {
+		opts map[string][]string
+		want string
+	}{
+		{nil, "sudo chmod +x '/tmp/a.sh' && sudo '/tmp/a.sh'"},
+		{map[string][]string{"sudo": {"true"}}, "sudo chmod +x '/tmp/a.sh' && sudo '/tmp/a.sh'"},
+		{map[string][]string{"sudo": {"false"}}, "chmod +x '/tmp/a.sh' && '/tmp/a.sh'"},
+		{map[string][]string{"interpreter": {"/bin/bash"}}, "sudo /bin/bash '/tmp/a.sh'"},
+		{map[string][]string{"interpreter": {"/bin/bash"}, "sudo": {"false"}}, "/bin/bash '/tmp/a.sh'"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ScriptCommand("/tmp/a.sh", tt.opts))
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	assert.Equal(t, `sudo sh -c 'systemctl restart nginx'`, CommandLine("systemctl restart nginx", nil))
+	assert.Equal(t, `sudo sh -c 'echo '\''hi'\'' | wc -c'`, CommandLine("echo 'hi' | wc -c", nil))
+	assert.Equal(t, "echo 'hi' | wc -c", CommandLine("echo 'hi' | wc -c", map[string][]string{"sudo": {"false"}}))
+
+	withPass := map[string][]string{BecomePassOpt: {"secret"}}
+	assert.Equal(t, `sudo -k -S -p '' sh -c 'exec </dev/null; systemctl restart nginx'`, CommandLine("systemctl restart nginx", withPass))
+	assert.Equal(t, `sudo -k -S -p '' sh -c 'exec </dev/null; chmod +x '\''/tmp/a.sh'\'' && '\''/tmp/a.sh'\'''`, ScriptCommand("/tmp/a.sh", withPass))
+	withPass["interpreter"] = []string{"/bin/bash"}
+	assert.Equal(t, `sudo -k -S -p '' sh -c 'exec </dev/null; /bin/bash '\''/tmp/a.sh'\'''`, ScriptCommand("/tmp/a.sh", withPass))
+}
+
+// fakeSudo checks the password read with -S, then runs the command as the current user
+const fakeSudo = `#!/bin/sh
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -k) shift ;;
+    -S) stdin=1; shift ;;
+    -p) shift 2 ;;
+    *) break ;;
+  esac
+done
+if [ -n "$stdin" ]; then
+  read -r pass
+  [ "$pass" = "secret" ] || { echo "sudo: 1 incorrect password attempt" >&2; exit 1; }
+fi
+exec "$@"
+`
+
+func TestExecuteScriptBecomePass(t *testing.T) {
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "sudo"), []byte(fakeSudo), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	srv := newTestServer(t)
+	srv.password = "ssh-secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	script := filepath.Join(t.TempDir(), "stdin.sh")
+	require.NoError(t, client.UploadScript([]byte("#!/bin/sh\necho \"stdin=[$(cat)]\"\n"), script))
+
+	// the script never reads the password
+	out, err := client.ExecuteScript(context.Background(), script, map[string][]string{BecomePassOpt: {"secret"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "stdin=[]\n", out.Stdout)
+
+	out, err = client.ExecuteScript(context.Background(), script, map[string][]string{BecomePassOpt: {"wrong"}}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, ExitStatus(err))
+	assert.NotContains(t, out.Stdout+out.Stderr, "wrong")
+
+	out, err = client.ExecuteCommand(context.Background(), "echo ok", map[string][]string{BecomePassOpt: {"secret"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok\n", out.Stdout)
+}
+
+func TestExecuteCommandWithoutSFTP(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{NoSFTP: true})
+	require.NoError(t, err)
+	defer client.Close()
+
+	var streamOut bytes.Buffer
+	out, err := client.ExecuteCommand(context.Background(), "echo 'a b' | tr ' ' -", map[string][]string{"sudo": {"false"}}, &Stream{Stdout: &streamOut})
+	assert.NoError(t, err)
+	assert.Equal(t, "a-b\n", out.Stdout)
+	assert.Equal(t, "a-b\n", streamOut.String())
+
+	_, err = client.ExecuteCommand(context.Background(), "exit 4", map[string][]string{"sudo": {"false"}}, nil)
+	assert.ErrorContains(t, err, "failed to execute command")
+	assert.Equal(t, 4, ExitStatus(err))
+
+	assert.Error(t, client.UploadScript([]byte("echo"), filepath.Join(t.TempDir(), "a.sh")))
+}
+
+func TestRunCommand(t *testing.T) {
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	out, err := client.RunCommand(context.Background(), "echo os=$(uname -s)")
+	assert.NoError(t, err)
+	assert.Contains(t, out.Stdout, "os=")
+
+	_, err = client.RunCommand(context.Background(), "exit 5")
+	assert.ErrorContains(t, err, "failed to run command")
+	assert.Equal(t, 5, ExitStatus(err))
+}
+
+func TestExecuteScriptContextDone(t *testing.T) {
+	prevGrace := signalGracePeriod
+	signalGracePeriod = 500 * time.Millisecond
+	t.Cleanup(func() { signalGracePeriod = prevGrace })
+
+	srv := newTestServer(t)
+	srv.password = "secret"
+	connInfo := srv.connInfo()
+	connInfo.Password = srv.password
+
+	client, err := NewSSHClient(context.Background(), connInfo, &Options{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	opts := map[string][]string{"sudo": {"false"}}
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"Stops on SIGTERM", "#!/bin/sh\necho started\nsleep 30\n"},
+		{"Ignores SIGTERM", "#!/bin/sh\ntrap '' TERM\necho started\nwhile true; do sleep 0.1; done\n"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := filepath.Join(dir, fmt.Sprintf("hang-%d.sh", i))
+			require.NoError(t, client.UploadScript([]byte(tt.script), script))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			out, err := client.ExecuteScript(ctx, script, opts, nil)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Equal(t, -1, ExitStatus(err))
+			assert.Equal(t, "started\n", out.Stdout)
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+
+	assert.Equal(t, []string{"TERM", "TERM"}, srv.receivedSignals())
+}
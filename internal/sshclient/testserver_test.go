@@ -0,0 +1,250 @@
+package rconf
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process SSH server used by the tests:
+// 'exec' requests are run with the local /bin/sh, the 'sftp' subsystem is served from the local filesystem.
+type testServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	user     string
+	password string
+	keys     []ssh.PublicKey
+	offered  []ssh.PublicKey // the public keys offered by the clients, in order
+
+	mu          sync.Mutex
+	hostCert    ssh.Signer // a certificate of the host key, offered with the key when set
+	connections int
+	commands    []string
+	signals     []string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &testServer{listener: listener, hostKey: newTestSigner(t), user: "test"}
+	t.Cleanup(func() { listener.Close() })
+	go srv.serve()
+	return srv
+}
+
+// connInfo returns connection details of the server, with host key checks disabled.
+func (srv *testServer) connInfo() connstr.ConnInfo {
+	host, port, _ := net.SplitHostPort(srv.listener.Addr().String())
+	return connstr.ConnInfo{
+		User: srv.user,
+		Host: host,
+		Port: port,
+		Opts: map[string][]string{"hostkey": {HostKeyOff}},
+	}
+}
+
+func (srv *testServer) addr() string {
+	return srv.listener.Addr().String()
+}
+
+// receivedSignals returns the names of the signals sent by the clients.
+func (srv *testServer) receivedSignals() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]string(nil), srv.signals...)
+}
+
+func (srv *testServer) connectionCount() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.connections
+}
+
+func (srv *testServer) config() *ssh.ServerConfig {
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if srv.password != "" && conn.User() == srv.user && string(password) == srv.password {
+				return nil, nil
+			}
+			return nil, errors.New("password rejected")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			srv.mu.Lock()
+			srv.offered = append(srv.offered, key)
+			srv.mu.Unlock()
+			for _, k := range srv.keys {
+				if conn.User() == srv.user && string(k.Marshal()) == string(key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, errors.New("public key rejected")
+		},
+	}
+	cfg.AddHostKey(srv.hostKey)
+	srv.mu.Lock()
+	if srv.hostCert != nil {
+		cfg.AddHostKey(srv.hostCert)
+	}
+	srv.mu.Unlock()
+	return cfg
+}
+
+func (srv *testServer) serve() {
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		go srv.handleConn(conn)
+	}
+}
+
+func (srv *testServer) handleConn(netConn net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(netConn, srv.config())
+	if err != nil {
+		netConn.Close()
+		return
+	}
+	defer conn.Close()
+
+	srv.mu.Lock()
+	srv.connections++
+	srv.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go srv.handleSession(newChannel)
+		case "direct-tcpip":
+			go srv.handleDirectTCPIP(newChannel)
+		default:
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// handleDirectTCPIP forwards connections, which makes the server usable as a jump host.
+func (srv *testServer) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, "invalid payload")
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		_, _ = io.Copy(target, channel)
+		target.Close()
+	}()
+	_, _ = io.Copy(channel, target)
+	channel.Close()
+}
+
+func (srv *testServer) handleSession(newChannel ssh.NewChannel) {
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	var cmd *exec.Cmd
+	done := make(chan struct{})
+	for req := range reqs {
+		switch req.Type {
+		case "exec":
+			command := string(req.Payload[4:])
+			srv.mu.Lock()
+			srv.commands = append(srv.commands, command)
+			srv.mu.Unlock()
+
+			cmd = exec.Command("/bin/sh", "-c", command)
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+			cmd.Stdin = channel
+			cmd.Stdout = channel
+			cmd.Stderr = channel.Stderr()
+			if err := cmd.Start(); err != nil {
+				_ = req.Reply(false, nil)
+				return
+			}
+			_ = req.Reply(true, nil)
+			go func() {
+				defer close(done)
+				status := 0
+				if err := cmd.Wait(); err != nil {
+					status = 255
+					var exitErr *exec.ExitError
+					if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+						status = exitErr.ExitCode()
+					}
+				}
+				statusPayload := make([]byte, 4)
+				binary.BigEndian.PutUint32(statusPayload, uint32(status))
+				_, _ = channel.SendRequest("exit-status", false, statusPayload)
+				channel.Close()
+			}()
+		case "subsystem":
+			if string(req.Payload[4:]) != "sftp" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			_ = server.Serve()
+			return
+		case "signal":
+			var sig struct{ Signal string }
+			_ = ssh.Unmarshal(req.Payload, &sig)
+			srv.mu.Lock()
+			srv.signals = append(srv.signals, sig.Signal)
+			srv.mu.Unlock()
+			if cmd != nil && cmd.Process != nil {
+				_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+			}
+		default:
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+
+	// the client closed the session, stop a command that is still running
+	if cmd != nil && cmd.Process != nil {
+		select {
+		case <-done:
+		default:
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+		}
+	}
+}
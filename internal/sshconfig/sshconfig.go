@@ -0,0 +1,337 @@
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+)
+
+// maxIncludeDepth limits nested Include directives (same as OpenSSH)
+const maxIncludeDepth = 16
+
+// HostConfig holds the client settings resolved for a host alias.
+type HostConfig struct {
+	HostName      string
+	User          string
+	Port          string
+	IdentityFiles []string
+	ProxyJump     string
+}
+
+// Config is a parsed OpenSSH client configuration (ssh_config(5)).
+//
+// Only the keywords used by rconf are interpreted: Host, Include, HostName, User, Port, IdentityFile, ProxyJump.
+// Match blocks are not supported and are skipped.
+type Config struct {
+	blocks []*block
+}
+
+// block is a Host (or Match) section with its parameters in file order
+type block struct {
+	patterns []string
+	match    bool
+	params   []param
+}
+
+type param struct {
+	key   string
+	value string
+}
+
+// DefaultPaths returns the user and the system config files, in lookup order.
+func DefaultPaths() []string {
+	paths := []string{}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".ssh", "config"))
+	}
+	return append(paths, "/etc/ssh/ssh_config")
+}
+
+// Load parses the given config files, missing files are ignored.
+func Load(paths ...string) (*Config, error) {
+	cfg := &Config{}
+	for _, path := range paths {
+		err := cfg.parseFile(path, []string{"*"}, filepath.Clean(path) == "/etc/ssh/ssh_config", 0)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// Parse parses a single config from the reader.
+func Parse(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	if err := cfg.parse(r, "<config>", []string{"*"}, false, 0); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) parseFile(path string, patterns []string, system bool, depth int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.parse(f, path, patterns, system, depth)
+}
+
+// parse reads the config lines, the lines before the first Host belong to the enclosing block
+// (everything at the top level of a file, or the Host block holding the Include)
+func (c *Config) parse(r io.Reader, name string, patterns []string, system bool, depth int) error {
+	current := &block{patterns: patterns}
+	c.blocks = append(c.blocks, current)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		key, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, lineNum, err)
+		}
+		if key == "" {
+			continue
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("%s:%d: missing argument for %s", name, lineNum, key)
+		}
+
+		switch key {
+		case "host":
+			current = &block{patterns: args}
+			c.blocks = append(c.blocks, current)
+		case "match":
+			current = &block{match: true}
+			c.blocks = append(c.blocks, current)
+		case "include":
+			if depth >= maxIncludeDepth {
+				return fmt.Errorf("%s:%d: too many nested includes", name, lineNum)
+			}
+			if err := c.include(args, current, system, depth); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, lineNum, err)
+			}
+			// the lines after the Include continue the enclosing block
+			current = &block{patterns: current.patterns, match: current.match}
+			c.blocks = append(c.blocks, current)
+		default:
+			current.params = append(current.params, param{key: key, value: strings.Join(args, " ")})
+		}
+	}
+	return scanner.Err()
+}
+
+// include parses the files matched by the Include globs, relative paths are resolved against ~/.ssh (or /etc/ssh)
+func (c *Config) include(globs []string, enclosing *block, system bool, depth int) error {
+	for _, glob := range globs {
+		glob = expandTilde(glob)
+		if !filepath.IsAbs(glob) {
+			if system {
+				glob = filepath.Join("/etc/ssh", glob)
+			} else {
+				home, err := os.UserHomeDir()
+				if err != nil {
+					return err
+				}
+				glob = filepath.Join(home, ".ssh", glob)
+			}
+		}
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			if enclosing.match {
+				// contents of an unsupported Match block are skipped
+				continue
+			}
+			if err := c.parseFile(m, enclosing.patterns, system, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup resolves the settings for the alias, the first obtained value of each keyword wins.
+func (c *Config) Lookup(alias string) *HostConfig {
+	hc := &HostConfig{}
+	for _, b := range c.blocks {
+		if b.match || !matchPatterns(b.patterns, alias) {
+			continue
+		}
+		for _, p := range b.params {
+			switch p.key {
+			case "hostname":
+				if hc.HostName == "" {
+					hc.HostName = p.value
+				}
+			case "user":
+				if hc.User == "" {
+					hc.User = p.value
+				}
+			case "port":
+				if hc.Port == "" {
+					hc.Port = p.value
+				}
+			case "identityfile":
+				hc.IdentityFiles = append(hc.IdentityFiles, p.value)
+			case "proxyjump":
+				if hc.ProxyJump == "" {
+					hc.ProxyJump = p.value
+				}
+			}
+		}
+	}
+
+	// expand the tokens (see TOKENS in ssh_config(5))
+	if hc.HostName != "" {
+		hc.HostName = strings.ReplaceAll(hc.HostName, "%h", alias)
+	} else {
+		hc.HostName = alias
+	}
+	if strings.EqualFold(hc.ProxyJump, "none") {
+		hc.ProxyJump = ""
+	}
+	return hc
+}
+
+// Apply fills the gaps in the connection details from the config, explicit values are kept.
+// The alias (the host given in the connection string) is replaced by the configured HostName.
+func (c *Config) Apply(info *connstr.ConnInfo) {
+	hc := c.Lookup(info.Host)
+
+	if info.User == "" {
+		info.User = hc.User
+	}
+	if info.Port == "" {
+		info.Port = hc.Port
+	}
+	info.Host = hc.HostName
+
+	if info.Opts == nil {
+		info.Opts = map[string][]string{}
+	}
+	if len(info.IdentityFiles) == 0 {
+		// like ssh, identity files that do not exist are silently skipped
+		for _, f := range hc.IdentityFiles {
+			f = expandIdentityFile(f, hc.HostName, info.User)
+			if _, err := os.Stat(f); err == nil {
+				info.IdentityFiles = append(info.IdentityFiles, f)
+			}
+		}
+	}
+	if _, ok := info.Opts["jump"]; !ok && hc.ProxyJump != "" {
+		info.Opts["jump"] = []string{hc.ProxyJump}
+	}
+}
+
+// splitLine returns the lowercased keyword and its arguments, 'Key value' and 'Key=value' forms are accepted
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	var args []string
+	for rest != "" {
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated quote")
+			}
+			args = append(args, rest[1:closing+1])
+			rest = strings.TrimSpace(rest[closing+2:])
+			continue
+		}
+		if rest[0] == '#' {
+			break
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			args = append(args, rest)
+			break
+		}
+		args = append(args, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+	return key, args, nil
+}
+
+// matchPatterns reports whether the host matches the Host patterns: one of the patterns must match
+// and none of the negated (!pattern) ones
+func matchPatterns(patterns []string, host string) bool {
+	matched := false
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			if wildcardMatch(p[1:], host) {
+				return false
+			}
+			continue
+		}
+		if wildcardMatch(p, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// wildcardMatch matches the ssh_config(5) patterns: '*' matches zero or more characters, '?' exactly one
+func wildcardMatch(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || !strings.EqualFold(pattern[:1], s[:1]) {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+func expandTilde(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+// expandIdentityFile expands '~' and the %d, %h, %r, %u and %% tokens
+func expandIdentityFile(path, host, remoteUser string) string {
+	home, _ := os.UserHomeDir()
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	replacer := strings.NewReplacer("%%", "%", "%d", home, "%h", host, "%r", remoteUser, "%u", localUser)
+	return replacer.Replace(expandTilde(path))
+}
@@ -0,0 +1,195 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashmap-kz/rconf/internal/connstr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+# global defaults come last in a typical config
+Host db-prod-1
+    HostName 10.40.240.10
+    User postgres
+    Port 2222
+
+Host web-* !web-legacy
+    HostName %h.dc1.example.com
+    User=deploy
+    ProxyJump bastion.example.com
+
+Host bastion
+    HostName "bastion.example.com"
+    ProxyJump none
+
+Match host *.internal
+    User nobody
+
+Host *
+    User admin
+    Port 22
+`
+
+func TestLookup(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(testConfig))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		alias string
+		want  HostConfig
+	}{
+		{
+			name:  "Exact alias",
+			alias: "db-prod-1",
+			want:  HostConfig{HostName: "10.40.240.10", User: "postgres", Port: "2222"},
+		},
+		{
+			name:  "Wildcard pattern with token",
+			alias: "web-01",
+			want:  HostConfig{HostName: "web-01.dc1.example.com", User: "deploy", Port: "22", ProxyJump: "bastion.example.com"},
+		},
+		{
+			name:  "Negated pattern",
+			alias: "web-legacy",
+			want:  HostConfig{HostName: "web-legacy", User: "admin", Port: "22"},
+		},
+		{
+			name:  "Quoted value and ProxyJump none",
+			alias: "bastion",
+			want:  HostConfig{HostName: "bastion.example.com", User: "admin", Port: "22"},
+		},
+		{
+			name:  "Match blocks are skipped",
+			alias: "db.internal",
+			want:  HostConfig{HostName: "db.internal", User: "admin", Port: "22"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, &tt.want, cfg.Lookup(tt.alias))
+		})
+	}
+}
+
+func TestLoadInclude(t *testing.T) {
+	dir := t.TempDir()
+	confD := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confD, 0o755))
+
+	require.NoError(t, os.WriteFile(filepath.Join(confD, "10-db.conf"), []byte(`
+Host db-*
+    User postgres
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(confD, "20-web.conf"), []byte(`
+Host web-*
+    User deploy
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "port.conf"), []byte(`
+Port 2200
+`), 0o600))
+
+	config := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(config, []byte(`
+Include `+filepath.Join(confD, "*.conf")+`
+
+Host db-prod-*
+    Include `+filepath.Join(dir, "port.conf")+`
+    HostName %h.example.com
+
+Host *
+    User admin
+`), 0o600))
+
+	cfg, err := Load(config, filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+
+	assert.Equal(t, &HostConfig{HostName: "db-prod-1.example.com", User: "postgres", Port: "2200"}, cfg.Lookup("db-prod-1"))
+	assert.Equal(t, &HostConfig{HostName: "db-test-1", User: "postgres"}, cfg.Lookup("db-test-1"))
+	assert.Equal(t, &HostConfig{HostName: "web-1", User: "deploy"}, cfg.Lookup("web-1"))
+	assert.Equal(t, &HostConfig{HostName: "other", User: "admin"}, cfg.Lookup("other"))
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader("Host\n"))
+	assert.ErrorContains(t, err, ":1:")
+
+	_, err = Parse(strings.NewReader("Host a\n  HostName \"unterminated\n"))
+	assert.ErrorContains(t, err, ":2:")
+}
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_db")
+	require.NoError(t, os.WriteFile(key, []byte("key"), 0o600))
+
+	cfg, err := Parse(strings.NewReader(`
+Host db-prod-1
+    HostName 10.40.240.10
+    User postgres
+    Port 2222
+    IdentityFile ` + key + `
+    IdentityFile ` + filepath.Join(dir, "missing") + `
+    ProxyJump bastion
+`))
+	require.NoError(t, err)
+
+	t.Run("Config fills the gaps", func(t *testing.T) {
+		info, err := connstr.ParsePartialConnectionString("db-prod-1")
+		require.NoError(t, err)
+		cfg.Apply(info)
+		assert.Equal(t, &connstr.ConnInfo{
+			User:          "postgres",
+			Host:          "10.40.240.10",
+			Port:          "2222",
+			Opts:          map[string][]string{"jump": {"bastion"}},
+			IdentityFiles: []string{key},
+		}, info)
+	})
+
+	t.Run("Explicit values win", func(t *testing.T) {
+		info, err := connstr.ParsePartialConnectionString("root:pass@db-prod-1:22?key=/other/key&jump=none-needed")
+		require.NoError(t, err)
+		cfg.Apply(info)
+		assert.Equal(t, &connstr.ConnInfo{
+			User:     "root",
+			Password: "pass",
+			Host:     "10.40.240.10",
+			Port:     "22",
+			Opts:     map[string][]string{"key": {"/other/key"}, "jump": {"none-needed"}},
+			// tried after the explicit key
+			IdentityFiles: []string{key},
+		}, info)
+	})
+
+	t.Run("Unknown alias", func(t *testing.T) {
+		info, err := connstr.ParsePartialConnectionString("10.0.0.1")
+		require.NoError(t, err)
+		cfg.Apply(info)
+		assert.Equal(t, &connstr.ConnInfo{Host: "10.0.0.1", Opts: map[string][]string{}}, info)
+	})
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		host     string
+		want     bool
+	}{
+		{[]string{"*"}, "anything", true},
+		{[]string{"web-??"}, "web-01", true},
+		{[]string{"web-??"}, "web-001", false},
+		{[]string{"*.example.com"}, "db.EXAMPLE.com", true},
+		{[]string{"*", "!db-*"}, "db-1", false},
+		{[]string{"!db-*"}, "web-1", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchPatterns(tt.patterns, tt.host), "%v %s", tt.patterns, tt.host)
+	}
+}
@@ -5,11 +5,12 @@ import (
 	"os"
 
 	"github.com/hashmap-kz/rconf/cmd"
+	"github.com/hashmap-kz/rconf/internal/runner"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(runner.ExitCode(err))
 	}
 }